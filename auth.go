@@ -1,122 +1,251 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
+	"os"
 	"strings"
 
-	"github.com/automattic/go/jaguar"
+	"github.com/mkaz/wpsync/wpsync"
+	"golang.org/x/term"
 )
 
+// setup values from the flags, so --init can run in scripts
+var setupURL string
+var setupUser string
+var passwordStdin bool
+var wpcom bool
+
+// stdin is shared by the prompts, separate readers would lose
+// input buffered by each other
+var stdin = bufio.NewReader(os.Stdin)
+
 // runSetup prompts the user for the necessary info to
 // configure and run. It can be triggered directly using
 // --init or will get triggered if testSetup fails
-func runSetup() {
-	var user, pass string
-
-	// prompt user for site
-	conf.SiteURL = promptForURL("Enter URL for site: ")
+func runSetup() error {
+	var err error
+	ctx := context.Background()
+
+	// site from --url or the environment, else prompt
+	siteURL := setupURL
+	if siteURL == "" {
+		siteURL = os.Getenv("WPSYNC_SITE_URL")
+	}
+	if siteURL == "" {
+		if nonInteractive {
+			return errors.New("Site URL needed, use --url or set WPSYNC_SITE_URL")
+		}
+		if siteURL, err = promptForURL("Enter URL for site: "); err != nil {
+			return err
+		}
+	} else if siteURL, err = checkURL(siteURL); err != nil {
+		return err
+	}
+	if siteURL != conf.SiteURL {
+		conf.APIRoot = "" // found again for the new site
+	}
+	conf.SiteURL = siteURL
 
-	// prompt for username
-	fmt.Print("Enter username: ")
-	_, err := fmt.Scanf("%s", &user)
+	client, err := wpsync.NewClientFromConfig(conf)
 	if err != nil {
-		log.Fatal("What happened?", err)
+		return fmt.Errorf("Error in HTTP settings: %v", err)
 	}
 
-	// prompt for password
-	fmt.Print("Enter password: ")
-	_, err = fmt.Scanf("%s", &pass)
+	var token string
+	if wpcom || conf.IsWPCom() {
+		conf.WPCom = wpcom || conf.WPCom
+		token, err = wpcomLogin(ctx)
+	} else {
+		token, err = jwtLogin(ctx, client)
+	}
 	if err != nil {
-		log.Fatal("What happened?", err)
+		return err
 	}
+	conf.Token = token
 
-	// make JWT call to fetch token
-	url := strings.Join([]string{conf.SiteURL, "wp-json", "jwt-auth/v1/token"}, "/")
-	j := jaguar.New()
-	j.Url(url)
-	j.Params.Add("username", user)
-	j.Params.Add("password", pass)
-	resp, err := j.Method("POST").Send()
-	if err != nil {
-		log.Fatal("API error authentication", err)
+	// the token is kept out of wpsync.json, which is often in git
+	if err := saveToken(conf.SiteURL, conf.Token); err != nil {
+		return fmt.Errorf("Error saving token: %v", err)
+	}
+	if command, _ := credentialCommand(conf.SiteURL); command != "" {
+		log.Warnf("credential-command is set, the new token is saved but the command is used to get it")
+	}
+
+	// write out config
+	if err := saveSite(conf.Site, conf); err != nil {
+		log.Warnf("Error writing %v: %v", configPath, err)
+	} else {
+		log.Debugf("%v written", configPath)
 	}
+	return nil
+}
 
-	if resp.StatusCode == 403 {
-		log.Fatal("Error authenticating, try again.")
+// jwtLogin checks the site before asking for credentials,
+// then gets a token from the JWT plugin
+func jwtLogin(ctx context.Context, client *wpsync.Client) (string, error) {
+	if conf.APIRoot == "" {
+		root, err := client.DiscoverAPIRoot(ctx)
+		if err != nil {
+			return "", fmt.Errorf("Error reaching %v: %v", conf.SiteURL, err)
+		}
+		// only saved when it is not the default /wp-json/
+		if root != conf.SiteURL+"/wp-json/" {
+			conf.APIRoot, client.APIRoot = root, root
+		}
+	}
+	idx, err := client.Index(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Error reaching the REST API of %v: %v", conf.SiteURL, err)
+	}
+	if !idx.HasNamespace("jwt-auth/v1") {
+		return "", errors.New("Auth API not found. JWT Auth plugin installed and activated?")
 	}
+	log.Infof("Found site %v", idx.Name)
 
-	if resp.StatusCode == 404 {
-		log.Fatal("Auth API not found. JWT Auth plugin installed and activated?")
+	user, err := promptForUser()
+	if err != nil {
+		return "", err
+	}
+	pass, err := promptForPassword()
+	if err != nil {
+		return "", err
 	}
 
-	if err := json.Unmarshal(resp.Bytes, &conf); err != nil {
-		log.Fatal("Error parsing JSON response", string(resp.Bytes), err)
+	// make JWT call to fetch token
+	token, err := client.RequestToken(ctx, user, pass)
+	if errors.Is(err, wpsync.ErrAuth) {
+		return "", fmt.Errorf("Error authenticating, try again: %v", err)
 	}
 
-	if conf.Token == "" {
-		log.Fatal("No authentication token.", resp.StatusCode, string(resp.Bytes))
+	if errors.Is(err, wpsync.ErrNotFound) {
+		return "", errors.New("Auth API not found. JWT Auth plugin installed and activated?")
 	}
 
-	// write out config
-	jsonConf, err := json.Marshal(conf)
 	if err != nil {
-		log.Warn("JSON Encoding Error", err)
-	} else {
-		err = ioutil.WriteFile("wpsync.json", jsonConf, 0644)
-		if err != nil {
-			log.Warn("Error writing wpsync.json", err)
-		} else {
-			log.Debug("wpsync.json written")
-		}
+		return "", fmt.Errorf("API error authentication: %v", err)
 	}
+	return token, nil
 }
 
 // testSetup confirms everything is configured and working
 // includes the local directories, blog config, and auth
 func testSetup() bool {
-	if conf.SiteURL == "" {
-		log.Warn("Site URL not set")
+	err := syncer.Check(context.Background())
+	if errors.Is(err, wpsync.ErrAuth) {
+		log.Warnf("Authentication error, try running --init: %v", err)
 		return false
 	}
 
-	if conf.Token == "" {
-		log.Warn("Authentication token not set")
+	if err != nil {
+		log.Warnf("Error in setup: %v", err)
 		return false
 	}
 
-	j := getApiFetcher("jwt-auth/v1/token/validate")
-	resp, err := j.Method("POST").Send()
-	if err != nil {
-		log.Warn("Error in Auth validation API", err)
+	return true
+}
+
+// runDiagnostics prints the --test checklist, it returns
+// false if any check failed
+func runDiagnostics() bool {
+	checks := syncer.Diagnose(context.Background())
+	for _, c := range checks {
+		mark := "✔"
+		switch c.Status {
+		case wpsync.CheckWarn:
+			mark = "!"
+		case wpsync.CheckFail:
+			mark = "✘"
+		}
+		fmt.Printf("%s %-16s %s\n", mark, c.Name, c.Detail)
 	}
+	return !wpsync.Failed(checks)
+}
 
-	if resp.StatusCode == 403 {
-		log.Warn("Authentication error. Try running --init ", string(resp.Bytes))
-		return false
+func promptForURL(prompt string) (string, error) {
+	input, err := readLine(prompt)
+	if err != nil {
+		return "", err
 	}
 
-	return true
+	siteURL, err := checkURL(input)
+	if err != nil {
+		log.Warnf("%v", err)
+		return promptForURL(prompt)
+	}
+	return siteURL, nil
 }
 
-func promptForURL(prompt string) string {
-	var input string
+// checkURL returns the site url without a trailing slash
+func checkURL(input string) (string, error) {
+	input = strings.TrimSuffix(strings.TrimSpace(input), "/")
+	u, err := url.ParseRequestURI(input)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("Error with URL %q. Be sure to include http:// prefix", input)
+	}
+	return input, nil
+}
 
-	fmt.Print(prompt)
-	_, err := fmt.Scanf("%s", &input)
-	if err != nil {
-		log.Fatal("What happened?", err)
+// promptForUser returns the username from --user or the
+// environment, else prompts for it
+func promptForUser() (string, error) {
+	user := setupUser
+	if user == "" {
+		user = os.Getenv("WPSYNC_USER")
+	}
+	if user != "" {
+		return user, nil
 	}
+	if nonInteractive || passwordStdin {
+		return "", errors.New("Username needed, use --user or set WPSYNC_USER")
+	}
+	return readLine("Enter username: ")
+}
 
-	input = strings.TrimSuffix(input, "/")
+// promptForPassword reads the password from stdin with
+// --password-stdin, else prompts without echoing it
+func promptForPassword() (string, error) {
+	if passwordStdin {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("Error reading password: %v", err)
+		}
+		// only the line ending, spaces may be part of it
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if nonInteractive {
+		return "", errors.New("Password needed, use --password-stdin")
+	}
+	return readSecret("Enter password: ")
+}
 
-	_, err = url.ParseRequestURI(input)
+// readSecret prompts and reads a line without echoing it
+// when stdin is a terminal
+func readSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return readLine(prompt)
+	}
+	fmt.Print(prompt)
+	secret, err := term.ReadPassword(fd)
+	fmt.Println()
 	if err != nil {
-		log.Warn("Error with URL. Be sure to include http:// prefix")
-		return promptForURL(prompt)
+		return "", fmt.Errorf("Error reading input: %v", err)
 	}
+	return string(secret), nil
+}
 
-	return input
+// readLine prompts and reads a line, without the line ending
+func readLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := stdin.ReadString('\n')
+	if err != nil && !(err == io.EOF && line != "") {
+		return "", fmt.Errorf("Error reading input: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
 }
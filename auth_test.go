@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestPasswordStdin keeps spaces and drops the line ending
+func TestPasswordStdin(t *testing.T) {
+	stdin = bufio.NewReader(strings.NewReader("pass word \r\n"))
+	passwordStdin = true
+	defer func() {
+		stdin = bufio.NewReader(os.Stdin)
+		passwordStdin = false
+	}()
+
+	pass, err := promptForPassword()
+	if err != nil || pass != "pass word " {
+		t.Errorf("Expected password with spaces, got %q %v", pass, err)
+	}
+	if _, err := promptForUser(); err == nil {
+		t.Error("Expected error for no user with --password-stdin")
+	}
+}
+
+// TestCheckURL needs a scheme and host
+func TestCheckURL(t *testing.T) {
+	if u, err := checkURL(" https://example.com/blog/ "); err != nil || u != "https://example.com/blog" {
+		t.Error("Expected url without trailing slash", u, err)
+	}
+	for _, bad := range []string{"example.com", "ftp://example.com", "https://"} {
+		if _, err := checkURL(bad); err == nil {
+			t.Error("Expected error for", bad)
+		}
+	}
+}
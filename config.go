@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mkaz/wpsync/wpsync"
+)
+
+const configFilename = "wpsync.json"
+
+// configPath is the config file used, from --config or found
+// by findConfig, wpsync.json in the current directory if none
+var configPath = configFilename
+
+// findConfig walks up from the current directory to the first
+// directory with wpsync.json, "" if there is none
+func findConfig() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		filename := filepath.Join(dir, configFilename)
+		if _, err := os.Stat(filename); err == nil {
+			return filename, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// envOverrides sets the url and token from the environment,
+// they take priority over the config file
+func envOverrides(conf *wpsync.Config) {
+	if v := os.Getenv("WPSYNC_SITE_URL"); v != "" {
+		conf.SiteURL = strings.TrimSuffix(v, "/")
+	}
+	if v := os.Getenv("WPSYNC_TOKEN"); v != "" {
+		conf.Token = v
+	}
+}
+
+// configFile is wpsync.json, the top level is the default site
+// and its settings are shared with the named sites
+type configFile struct {
+	wpsync.Config
+	Sites map[string]json.RawMessage `json:"sites,omitempty"`
+
+	// CredentialCommand is only read to warn it is ignored, it
+	// is run so must come from the per-user settings
+	CredentialCommand string `json:"credential-command,omitempty"`
+}
+
+// loadConfig reads the config for a site, "" for the default.
+// A named site has its own url and token and may override
+// any of the shared settings.
+func loadConfig(site string) (wpsync.Config, error) {
+	var cf configFile
+	cf.Site = site
+	file, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return cf.Config, err
+	}
+	if err := json.Unmarshal(file, &cf); err != nil {
+		return cf.Config, fmt.Errorf("Error parsing %v: %v", configPath, err)
+	}
+
+	warnCredentialCommand(cf.CredentialCommand)
+	conf := cf.Config
+	if site == "" {
+		return conf, nil
+	}
+
+	// url, API root and auth, WordPress.com mode included, are
+	// never shared, the wrong site would be used
+	conf.SiteURL, conf.Token, conf.APIRoot = "", "", ""
+	conf.WPCom, conf.WPComClientID = false, ""
+	raw, ok := cf.Sites[site]
+	if !ok {
+		return conf, os.ErrNotExist
+	}
+	sf := configFile{Config: conf}
+	if err := json.Unmarshal(raw, &sf); err != nil {
+		return conf, fmt.Errorf("Error parsing site %v in %v: %v", site, configPath, err)
+	}
+	warnCredentialCommand(sf.CredentialCommand)
+	return sf.Config, nil
+}
+
+// warnCredentialCommand warns that a credential-command found
+// in wpsync.json is not run
+func warnCredentialCommand(command string) {
+	if command == "" {
+		return
+	}
+	filename, err := userConfigPath()
+	if err != nil {
+		filename = "the per-user config.json"
+	}
+	log.Warnf("credential-command in %v is ignored, set it in %v", configPath, filename)
+}
+
+// saveSite writes the url and API settings of a site to the
+// config, keeping the rest of the file as it is. A token from an
+// older version is removed, it is in the credentials file now.
+func saveSite(site string, c wpsync.Config) error {
+	root := map[string]interface{}{}
+	if file, err := ioutil.ReadFile(configPath); err == nil {
+		if err := json.Unmarshal(file, &root); err != nil {
+			return fmt.Errorf("Error parsing %v: %v", configPath, err)
+		}
+	}
+
+	settings := root
+	if site != "" {
+		sites, _ := root["sites"].(map[string]interface{})
+		if sites == nil {
+			sites = map[string]interface{}{}
+			root["sites"] = sites
+		}
+		settings, _ = sites[site].(map[string]interface{})
+		if settings == nil {
+			settings = map[string]interface{}{}
+			sites[site] = settings
+		}
+	}
+	settings["site-url"] = c.SiteURL
+	setOrDelete(settings, "api-root", c.APIRoot)
+	setOrDelete(settings, "wpcom-client-id", c.WPComClientID)
+	if c.WPCom {
+		settings["wpcom"] = true
+	} else {
+		delete(settings, "wpcom")
+	}
+	delete(settings, "token")
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configPath, data, 0644)
+}
+
+// setOrDelete sets key to value, or deletes it when empty
+func setOrDelete(settings map[string]interface{}, key, value string) {
+	if value != "" {
+		settings[key] = value
+	} else {
+		delete(settings, key)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mkaz/wpsync/wpsync"
+)
+
+// TestSiteConfig shares settings but not the url, API root,
+// WordPress.com mode or auth with named sites
+func TestSiteConfig(t *testing.T) {
+	dir, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(dir)
+
+	data := `{"site-url": "https://example.com", "token": "prod", "retries": 5,
+		"api-root": "https://example.com/?rest_route=/",
+		"wpcom": true, "wpcom-client-id": "123",
+		"sites": {"staging": {"site-url": "https://staging.example.com", "retries": 1}}}`
+	if err := ioutil.WriteFile(configPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadConfig("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Site != "staging" || c.SiteURL != "https://staging.example.com" || c.Token != "" || c.APIRoot != "" || c.IsWPCom() || c.WPComClientID != "" || c.Retries == nil || *c.Retries != 1 {
+		t.Error("Staging config wrong", c)
+	}
+	if _, err := loadConfig("missing"); !os.IsNotExist(err) {
+		t.Error("Expected not exist for missing site", err)
+	}
+
+	if err := saveSite("staging", wpsync.Config{SiteURL: "https://new.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	c, _ = loadConfig("staging")
+	if c.SiteURL != "https://new.example.com" || c.APIRoot != "" || c.IsWPCom() || c.Retries == nil || *c.Retries != 1 {
+		t.Error("Staging url not saved", c)
+	}
+	c, _ = loadConfig("")
+	if c.Token != "prod" || c.APIRoot != "https://example.com/?rest_route=/" || !c.WPCom || c.Retries == nil || *c.Retries != 5 {
+		t.Error("Default site changed", c)
+	}
+}
+
+// TestFindConfig walks up to wpsync.json and the environment
+// overrides it
+func TestFindConfig(t *testing.T) {
+	dir, _ := os.Getwd()
+	root := t.TempDir()
+	defer os.Chdir(dir)
+
+	sub := filepath.Join(root, "posts", "trip")
+	os.MkdirAll(sub, 0755)
+	ioutil.WriteFile(filepath.Join(root, configFilename), []byte(`{"site-url": "https://example.com", "token": "file"}`), 0644)
+	os.Chdir(sub)
+
+	found, err := findConfig()
+	if err != nil || filepath.Base(filepath.Dir(found)) != filepath.Base(root) {
+		t.Fatal("Expected config in", root, "got", found, err)
+	}
+
+	os.Setenv("WPSYNC_TOKEN", "env")
+	defer os.Unsetenv("WPSYNC_TOKEN")
+	configPath = found
+	defer func() { configPath = configFilename }()
+	c, _ := loadConfig("")
+	envOverrides(&c)
+	if c.SiteURL != "https://example.com" || c.Token != "env" {
+		t.Error("Expected token from environment", c)
+	}
+}
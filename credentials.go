@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// userConfigDir returns the per-user config directory,
+// a variable so tests can change it
+var userConfigDir = os.UserConfigDir
+
+// credentialsPath returns the file tokens are kept in, only
+// readable by the user and outside of the site directory
+func credentialsPath() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "wpsync", "credentials.json"), nil
+}
+
+// userConfigPath returns the per-user settings file, kept with
+// the credentials file
+func userConfigPath() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "wpsync", "config.json"), nil
+}
+
+// userConfig is the per-user settings, for settings that must
+// not come from wpsync.json, which may be from an untrusted
+// repository or a parent directory
+type userConfig struct {
+	// CredentialCommands get the token, by site url
+	CredentialCommands map[string]string `json:"credential-command"`
+}
+
+// loadUserConfig reads the per-user settings, empty if the
+// file does not exist
+func loadUserConfig() (uc userConfig, err error) {
+	filename, err := userConfigPath()
+	if err != nil {
+		return uc, err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return uc, nil
+	} else if err != nil {
+		return uc, err
+	}
+	if err := json.Unmarshal(data, &uc); err != nil {
+		return uc, fmt.Errorf("Error parsing %v: %v", filename, err)
+	}
+	return uc, nil
+}
+
+// credentialCommand returns the command for a site from the
+// per-user settings, "" if none
+func credentialCommand(siteURL string) (string, error) {
+	uc, err := loadUserConfig()
+	return uc.CredentialCommands[siteURL], err
+}
+
+// loadCredentials reads the tokens keyed by site url, empty
+// if the file does not exist yet
+func loadCredentials() (map[string]string, error) {
+	creds := map[string]string{}
+	filename, err := credentialsPath()
+	if err != nil {
+		return creds, err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return creds, nil
+	} else if err != nil {
+		return creds, err
+	}
+
+	if fi, err := os.Stat(filename); err == nil && fi.Mode().Perm()&0077 != 0 && runtime.GOOS != "windows" {
+		log.Warnf("%v can be read by other users, run: chmod 600 %v", filename, filename)
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return creds, fmt.Errorf("Error parsing %v: %v", filename, err)
+	}
+	return creds, nil
+}
+
+// loadToken returns the saved token for a site, "" if none
+func loadToken(siteURL string) (string, error) {
+	creds, err := loadCredentials()
+	return creds[siteURL], err
+}
+
+// saveToken saves the token for a site in the credentials file
+func saveToken(siteURL, token string) error {
+	creds, err := loadCredentials()
+	if err != nil {
+		return err
+	}
+	creds[siteURL] = token
+
+	filename, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(filename, 0600)
+}
+
+// findToken gets the token from the site's credential-command
+// if set, otherwise from the credentials file
+func findToken(siteURL string) (string, error) {
+	command, err := credentialCommand(siteURL)
+	if err != nil {
+		return "", err
+	}
+	if command != "" {
+		return runCredentialCommand(command)
+	}
+	return loadToken(siteURL)
+}
+
+// runCredentialCommand runs the command with the shell and
+// returns its output as the token
+func runCredentialCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("credential-command failed: %v", err)
+	}
+
+	token := strings.TrimSpace(out.String())
+	if token == "" {
+		return "", errors.New("credential-command returned no token")
+	}
+	return token, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestSaveToken keeps tokens per site in a private file
+func TestSaveToken(t *testing.T) {
+	dir := t.TempDir()
+	userConfigDir = func() (string, error) { return dir, nil }
+	defer func() { userConfigDir = os.UserConfigDir }()
+
+	if token, err := loadToken("https://example.com"); err != nil || token != "" {
+		t.Error("Expected no token before saving", token, err)
+	}
+	saveToken("https://example.com", "one")
+	saveToken("https://staging.example.com", "two")
+
+	if token, err := findToken("https://example.com"); err != nil || token != "one" {
+		t.Error("Expected saved token", token, err)
+	}
+
+	filename, _ := credentialsPath()
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Error("Expected credentials mode 0600, got", fi.Mode().Perm())
+	}
+}
+
+// TestCredentialCommand uses the output of the command set
+// in the per-user config, never one from wpsync.json
+func TestCredentialCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	userConfigDir = func() (string, error) { return dir, nil }
+	defer func() { userConfigDir = os.UserConfigDir }()
+
+	configPath = filepath.Join(dir, configFilename)
+	defer func() { configPath = configFilename }()
+	ioutil.WriteFile(configPath, []byte(`{"site-url": "https://example.com", "credential-command": "echo untrusted"}`), 0644)
+	conf, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveToken(conf.SiteURL, "saved")
+	if token, err := findToken(conf.SiteURL); err != nil || token != "saved" {
+		t.Error("Expected credential-command in wpsync.json ignored", token, err)
+	}
+
+	filename, _ := userConfigPath()
+	ioutil.WriteFile(filename, []byte(`{"credential-command": {"https://example.com": "echo secret", "https://bad.example.com": "exit 1"}}`), 0600)
+	if token, err := findToken("https://example.com"); err != nil || token != "secret" {
+		t.Error("Expected token from command", token, err)
+	}
+	if _, err := findToken("https://bad.example.com"); err == nil {
+		t.Error("Expected error from failed command")
+	}
+}
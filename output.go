@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/mkaz/wpsync/wpsync"
+)
+
+// output formats
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// output format and report file from the flags
+var output = outputText
+var reportFile string
+
+// eventOut is where JSON events are written
+var eventOut io.Writer = os.Stdout
+
+// Report is the run report written with --report
+type Report struct {
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Site     string         `json:"site"`
+	Dryrun   bool           `json:"dryrun"`
+	Summary  wpsync.Summary `json:"summary"`
+	Events   []wpsync.Event `json:"events"`
+}
+
+// writeEvent writes an event with --output json
+func writeEvent(ev wpsync.Event) {
+	writeJSONLine(ev)
+}
+
+// finish prints the totals and failures, or the summary
+// object with --output json, and writes the report file.
+// A dry run has what would change instead.
+func finish(s wpsync.Summary) {
+	if output == outputJSON {
+		writeJSONLine(struct {
+			Event  string `json:"event"`
+			Dryrun bool   `json:"dryrun,omitempty"`
+			wpsync.Summary
+		}{"summary", dryrun, s})
+	} else if dryrun {
+		log.Infof("Dry run: %d to create, %d to update, %d unchanged", s.Created, s.Updated, s.Skipped)
+	} else {
+		log.Infof("Done: %d created, %d updated, %d linked, %d unchanged, %d failed",
+			s.Created, s.Updated, s.Linked, s.Skipped, s.Failed)
+		for _, f := range s.Failures {
+			log.Errorf("Failed to %s %s %s: %v", f.Action, f.Type, f.File, f.Error)
+		}
+	}
+
+	if reportFile != "" {
+		if err := writeReport(reportFile, s); err != nil {
+			log.Warnf("Error writing report %v: %v", reportFile, err)
+		}
+	}
+}
+
+// writeReport writes the summary and all events as JSON
+func writeReport(filename string, s wpsync.Summary) error {
+	report := Report{
+		Started:  s.Started,
+		Finished: s.Finished,
+		Site:     conf.SiteURL,
+		Dryrun:   dryrun,
+		Summary:  s,
+		Events:   s.Events,
+	}
+	if report.Events == nil {
+		report.Events = []wpsync.Event{}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// writeJSONLine writes v as a single line of JSON
+func writeJSONLine(v interface{}) {
+	if err := json.NewEncoder(eventOut).Encode(v); err != nil {
+		log.Warnf("Error writing JSON output: %v", err)
+	}
+}
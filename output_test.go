@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mkaz/wpsync/wpsync"
+)
+
+// TestJSONOutput writes an event per item and the report
+func TestJSONOutput(t *testing.T) {
+	dir, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(dir)
+	output, reportFile = outputJSON, "report.json"
+	var buf bytes.Buffer
+	eventOut = &buf
+	defer func() {
+		output, reportFile = outputText, ""
+		eventOut = os.Stdout
+	}()
+
+	created := wpsync.Event{Event: "created", Type: "post", File: "posts/a.md", Id: 1, URL: "https://example.com/a"}
+	skipped := wpsync.Event{Event: "skipped", Type: "page", File: "pages/b.md"}
+	writeEvent(created)
+	writeEvent(skipped)
+	finish(wpsync.Summary{Created: 1, Skipped: 1, Events: []wpsync.Event{created, skipped}})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatal("Expected 3 lines of JSON", buf.String())
+	}
+	var ev wpsync.Event
+	if err := json.Unmarshal([]byte(lines[0]), &ev); err != nil || ev.Event != "created" || ev.Id != 1 || ev.File != "posts/a.md" {
+		t.Error("Created event not written", lines[0], err)
+	}
+	if !strings.Contains(lines[2], `"event":"summary","created":1,"updated":0,"linked":0,"skipped":1,"failed":0`) {
+		t.Error("Summary not written", lines[2])
+	}
+
+	var report Report
+	data, _ := ioutil.ReadFile("report.json")
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal("Error reading report", err)
+	}
+	if report.Summary.Created != 1 || len(report.Events) != 2 {
+		t.Error("Report incomplete", report)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mkaz/wpsync/wpsync"
+)
+
+// debounce is how long to wait after the last change before
+// syncing, editors often write a file several times on save
+const debounce = 500 * time.Millisecond
+
+// watch syncs changed files in the content directories until
+// the context is cancelled
+func watch(ctx context.Context) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	var dirs []string
+	for _, dir := range conf.ContentDirs() {
+		if _, err := os.Stat(dir); err == nil {
+			if err := watchTree(w, dir); err != nil {
+				return err
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return errors.New("No posts, pages or media directory to watch")
+	}
+	log.Infof("Watching %v for changes, press Ctrl-C to stop", strings.Join(dirs, ", "))
+
+	pending := map[string]bool{}
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op == fsnotify.Chmod || ignoredFile(ev.Name) {
+				continue
+			}
+			// watch a new directory, such as a post bundle, and
+			// its files that were created before it was watched
+			if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+				if ev.Op&fsnotify.Create != 0 {
+					watchTree(w, ev.Name)
+					filepath.Walk(ev.Name, func(path string, fi os.FileInfo, err error) error {
+						if err == nil && !fi.IsDir() && !ignoredFile(path) {
+							pending[path] = true
+						}
+						return nil
+					})
+					timer.Reset(debounce)
+				}
+				continue
+			}
+			log.Debugf("Changed %v %v", ev.Op, ev.Name)
+			pending[ev.Name] = true
+			timer.Reset(debounce)
+
+		case err := <-w.Errors:
+			log.Warnf("Error watching files: %v", err)
+
+		case <-timer.C:
+			var paths []string
+			for p := range pending {
+				paths = append(paths, p)
+			}
+			pending = map[string]bool{}
+
+			summary, err := syncer.PushFiles(ctx, paths)
+			printSync(summary)
+			if errors.Is(err, wpsync.ErrAuth) || ctx.Err() != nil {
+				return err
+			} else if err != nil {
+				log.Errorf("%v", err)
+			}
+		}
+	}
+}
+
+// watchTree watches a directory and all directories in it
+func watchTree(w *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return err
+		}
+		return w.Add(path)
+	})
+}
+
+// ignoredFile returns true for hidden and editor temp files
+func ignoredFile(filename string) bool {
+	name := filepath.Base(filename)
+	switch {
+	case strings.HasPrefix(name, "."), strings.HasPrefix(name, "#"), strings.HasSuffix(name, "~"):
+		return true
+	case strings.HasSuffix(name, ".swp"), strings.HasSuffix(name, ".swx"), strings.HasSuffix(name, ".tmp"):
+		return true
+	}
+	return false
+}
+
+// printSync prints a line for a sync that changed something,
+// saves to unchanged files are not shown
+func printSync(s wpsync.Summary) {
+	var changes []string
+	for _, ev := range s.Events {
+		if ev.Event != "skipped" {
+			changes = append(changes, ev.File+" "+ev.Event)
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	sort.Strings(changes)
+	log.Infof("%s synced %s", time.Now().Format("15:04:05"), strings.Join(changes, ", "))
+	for _, f := range s.Failures {
+		log.Errorf("Failed to %s %s %s: %v", f.Action, f.Type, f.File, f.Error)
+	}
+}
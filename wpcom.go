@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/mkaz/wpsync/wpsync"
+)
+
+// defaultRedirect is the callback wpsync listens on for the
+// WordPress.com login, register it as the app's redirect URL
+const defaultRedirect = "http://localhost:8765/callback"
+
+// loginTimeout is how long to wait for the browser login
+const loginTimeout = 5 * time.Minute
+
+// openBrowser shows the login page url, a variable so tests
+// can follow it instead
+var openBrowser = func(authURL string) {
+	fmt.Println("Open this URL in your browser to log in to WordPress.com:")
+	fmt.Println(authURL)
+}
+
+// wpcomLogin gets a token with the WordPress.com OAuth2 login,
+// the browser is sent back with a code to a local callback
+func wpcomLogin(ctx context.Context) (string, error) {
+	if nonInteractive {
+		return "", errors.New("WordPress.com login needs a browser, set WPSYNC_TOKEN instead")
+	}
+
+	var err error
+	if conf.WPComClientID == "" {
+		if conf.WPComClientID, err = readLine("Enter WordPress.com app client ID: "); err != nil {
+			return "", err
+		}
+	}
+	secret := os.Getenv("WPSYNC_WPCOM_SECRET")
+	if secret == "" {
+		if secret, err = readSecret("Enter WordPress.com app client secret: "); err != nil {
+			return "", err
+		}
+	}
+
+	redirect := conf.WPComRedirect
+	if redirect == "" {
+		redirect = defaultRedirect
+	}
+	code, redirect, err := waitForCode(ctx, redirect, func(redirect, state string) {
+		openBrowser(wpsync.AuthorizeURL(conf, conf.WPComClientID, redirect, state))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	client, err := wpsync.NewClientFromConfig(conf)
+	if err != nil {
+		return "", fmt.Errorf("Error in HTTP settings: %v", err)
+	}
+	token, err := client.ExchangeCode(ctx, conf.WPComClientID, secret, redirect, code)
+	if err != nil {
+		return "", fmt.Errorf("Error logging in to WordPress.com: %v", err)
+	}
+	return token, nil
+}
+
+// waitForCode listens on the redirect url, calls open with it
+// and a random state, and returns the code the browser is sent
+// back with. Port 0 listens on any free port, for tests.
+func waitForCode(ctx context.Context, redirect string, open func(redirect, state string)) (code, used string, err error) {
+	u, err := url.Parse(redirect)
+	if err != nil {
+		return "", "", fmt.Errorf("Error in wpcom-redirect: %v", err)
+	}
+	ln, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return "", "", fmt.Errorf("Error listening for the login callback: %v", err)
+	}
+	u.Host = ln.Addr().String()
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	state := hex.EncodeToString(b)
+
+	// only the first result is used, later requests do not block
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != u.Path:
+			http.NotFound(w, r)
+			return
+		case r.FormValue("state") != state:
+			http.Error(w, "Login state does not match, try again.", http.StatusBadRequest)
+			fail(errors.New("Login state does not match"))
+		case r.FormValue("error") != "":
+			http.Error(w, "Login failed, you can close this window.", http.StatusBadRequest)
+			fail(fmt.Errorf("Login failed: %v %v", r.FormValue("error"), r.FormValue("error_description")))
+		default:
+			fmt.Fprint(w, "Logged in to wpsync, you can close this window.")
+			select {
+			case codes <- r.FormValue("code"):
+			default:
+			}
+		}
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	open(u.String(), state)
+
+	ctx, cancel := context.WithTimeout(ctx, loginTimeout)
+	defer cancel()
+	select {
+	case code := <-codes:
+		return code, u.String(), nil
+	case err := <-errs:
+		return "", "", err
+	case <-ctx.Done():
+		return "", "", errors.New("Timed out waiting for the WordPress.com login")
+	}
+}
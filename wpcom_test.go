@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/mkaz/wpsync/wpsync"
+)
+
+// TestWPComLogin follows the OAuth2 login against a stand-in
+// for the WordPress.com API
+func TestWPComLogin(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/token" || r.FormValue("code") != "abc" || r.FormValue("client_secret") != "shh" {
+			http.Error(w, `{"code": "invalid_grant", "message": "bad code"}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "wpcom-token", "token_type": "bearer"}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	conf = wpsync.Config{
+		SiteURL:       "https://example.wordpress.com",
+		WPComAPI:      ts.URL,
+		WPComClientID: "123",
+		WPComRedirect: "http://127.0.0.1:0/callback",
+	}
+	os.Setenv("WPSYNC_WPCOM_SECRET", "shh")
+	defer func() {
+		conf = wpsync.Config{}
+		os.Unsetenv("WPSYNC_WPCOM_SECRET")
+	}()
+
+	// the browser logs in and is sent to the callback
+	savedBrowser := openBrowser
+	defer func() { openBrowser = savedBrowser }()
+	openBrowser = func(authURL string) {
+		u, _ := url.Parse(authURL)
+		q := u.Query()
+		if q.Get("client_id") != "123" || q.Get("blog") != "example.wordpress.com" {
+			t.Error("Authorize url missing client or blog", authURL)
+		}
+		go http.Get(q.Get("redirect_uri") + "?code=abc&state=" + q.Get("state"))
+	}
+
+	token, err := wpcomLogin(context.Background())
+	if err != nil || token != "wpcom-token" {
+		t.Error("Expected token from code", token, err)
+	}
+}
@@ -5,61 +5,33 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"time"
-)
-
-// Config is the structure of the jwt-auth response and
-// settings, it is used to unmarshal the data
-type Config struct {
-	SiteURL string `json:"site-url"`
-	Token   string `json:"token"`
-}
-
-type Post struct {
-	Id        int    `json:"id"`
-	Title     string `json:"-"`
-	Date      string `json:"-"`
-	URL       string `json:"link"`
-	Content   string `json:"-"`
-	Category  string `json:"-"`
-	Status    string `json:"status"`
-	Tags      string `json:"-"`
-	LocalFile string
-	ModDate   time.Time `json:"-"`
-	SyncDate  time.Time
-}
+	"os/signal"
+	"path/filepath"
 
-type Page struct {
-	Id        int    `json:"id"`
-	Title     string `json:"-"`
-	URL       string `json:"link"`
-	Content   string `json:"-"`
-	Status    string `json:"status"`
-	ParentId  int    `json:"-"`
-	Template  string `json:"-"`
-	Order     string `json:"-"`
-	LocalFile string
-	ModDate   time.Time `json:"-"`
-	SyncDate  time.Time
-}
-
-type Media struct {
-	Id        int    `json:"id"`
-	URL       string `json:"source_url"`
-	Link      string `json:"link"`
-	LocalFile string
-}
+	"github.com/mkaz/wpsync/wpsync"
+)
 
-var conf Config
-var log Logger
+var conf wpsync.Config
+var log = wpsync.NewLogger()
 var setup bool
 var dryrun bool
 var confirm bool
+var failFast bool
+var command string
+var site string
+var promoteFrom string
+var nonInteractive bool
+
+// dir is the directory of the config found up the tree, content
+// and state are in it, "" for the current directory
+var dir string
+
+// syncer for the configured site
+var syncer *wpsync.Syncer
 
 // read config and parse args
 func myInit() {
@@ -67,34 +39,123 @@ func myInit() {
 	var helpFlag = flag.Bool("help", false, "Display help and quit")
 	var versionFlag = flag.Bool("version", false, "Display version and quit")
 	var testFlag = flag.Bool("test", false, "Test config and authentication")
-	flag.BoolVar(&log.Quiet, "quiet", false, "Do not display info messages")
-	flag.BoolVar(&log.DebugLevel, "debug", false, "Display debug messages")
+	var quietFlag = flag.Bool("quiet", false, "Do not display info messages")
+	var debugFlag = flag.Bool("debug", false, "Display debug messages")
+	var logFile = flag.String("log-file", "", "Append all messages to file")
+	flag.BoolVar(&log.Timestamps, "timestamps", false, "Show the time of each message")
 	flag.BoolVar(&dryrun, "dryrun", false, "Test run, shows what will happen")
 	flag.BoolVar(&setup, "init", false, "Create settings for blog and auth")
+	flag.StringVar(&setupURL, "url", "", "Site URL for --init")
+	flag.StringVar(&setupUser, "user", "", "Username for --init")
+	flag.BoolVar(&wpcom, "wpcom", false, "Log in to a WordPress.com site for --init")
+	flag.BoolVar(&passwordStdin, "password-stdin", false, "Read the password for --init from stdin")
 	flag.BoolVar(&confirm, "confirm", false, "Confirm prompt before upload")
+	var configFlag = flag.String("config", "", "Path to the config file")
+	flag.BoolVar(&nonInteractive, "non-interactive", false, "Fail instead of prompting for input")
+	flag.StringVar(&site, "site", "", "Name of the site in wpsync.json to sync")
+	flag.BoolVar(&failFast, "fail-fast", false, "Stop at the first item that fails")
+	flag.StringVar(&output, "output", outputText, "Output format, text or json")
+	flag.StringVar(&reportFile, "report", "", "Write a JSON run report to file")
 	flag.Parse()
 
 	if *helpFlag {
 		usage()
 	}
 
+	switch {
+	case *debugFlag:
+		log.Level = wpsync.LevelDebug
+	case *quietFlag:
+		log.Level = wpsync.LevelWarn
+	}
+	wpsync.SetLogger(log)
+
+	if *logFile != "" {
+		if err := log.OpenLogFile(*logFile); err != nil {
+			fatalf("Error opening log file: %v", err)
+		}
+	}
+
+	if output != outputText && output != outputJSON {
+		fatalf("Unknown output format %v", output)
+	}
+
 	if *versionFlag {
-		fmt.Println("wpsync v0.2.0")
+		fmt.Println("wpsync v" + wpsync.Version)
 		os.Exit(0)
 	}
 
-	file, err := ioutil.ReadFile("wpsync.json")
-	if err != nil {
-		log.Debug("wpsync.json file not found, running setup", err)
-		setup = true
-	} else {
-		if err := json.Unmarshal(file, &conf); err != nil {
-			log.Fatal("Error parsing wpsync.json", err)
+	// content and state are relative to the config found up the
+	// tree, like git, --config keeps the current directory
+	if *configFlag != "" {
+		configPath = *configFlag
+	} else if found, err := findConfig(); err != nil {
+		fatalf("Error finding %v: %v", configFilename, err)
+	} else if found != "" {
+		configPath, dir = found, filepath.Dir(found)
+		log.Debugf("Using %v", found)
+	}
+
+	if nonInteractive && confirm {
+		fatalf("Can not use --confirm with --non-interactive")
+	}
+
+	// commands
+	switch flag.Arg(0) {
+	case "", "migrate", "reconcile", "watch":
+		command = flag.Arg(0)
+	case "promote":
+		if flag.NArg() != 3 || site != "" {
+			log.Warnf("Usage: wpsync promote <from-site> <to-site>")
+			usage()
 		}
+		command = flag.Arg(0)
+		promoteFrom, site = flag.Arg(1), flag.Arg(2)
+	default:
+		log.Warnf("Unknown command %v", flag.Arg(0))
+		usage()
+	}
+
+	var err error
+	conf, err = loadConfig(site)
+	if err != nil && !os.IsNotExist(err) {
+		fatalf("%v", err)
+	}
+	conf.Dir = dir
+
+	if command == "migrate" {
+		newSyncer()
+		if err := syncer.MigrateState(); err != nil {
+			fatalf("Error migrating state: %v", err)
+		}
+		os.Exit(0)
+	}
+	if conf.Token != "" {
+		log.Warnf("Token found in %v, run wpsync --init to move it to the credentials file", configPath)
+	}
+	envOverrides(&conf)
+
+	if conf.Token == "" && conf.SiteURL != "" {
+		if conf.Token, err = findToken(conf.SiteURL); err != nil {
+			fatalf("Error getting token: %v", err)
+		}
+	}
+
+	if conf.SiteURL == "" || conf.Token == "" {
+		if nonInteractive && !setup {
+			fatalf("Settings for %v not found, run wpsync --init or set WPSYNC_SITE_URL and WPSYNC_TOKEN", siteName(site))
+		}
+		log.Debugf("Settings for %v not found, running setup", siteName(site))
+		setup = true
+	}
+	newSyncer()
+
+	if syncer.NeedsMigration() {
+		fatalf("Found old posts.json, pages.json or media.json, run: wpsync migrate")
 	}
 
 	if *testFlag {
-		if testSetup() {
+		if runDiagnostics() {
 			fmt.Println("Test setup passed. 👍")
 			os.Exit(0)
 		} else {
@@ -104,7 +165,10 @@ func myInit() {
 	}
 
 	if setup {
-		runSetup()
+		if err := runSetup(); err != nil {
+			fatalf("%v", err)
+		}
+		newSyncer()
 	}
 
 	// test setup
@@ -112,11 +176,28 @@ func myInit() {
 		// setup not working
 		// check if runSetup() ran with setup
 		// if not run it now otherwise bail
-		log.Fatal("Error validating.", conf)
+		fatalf("Error validating setup for %v", conf.SiteURL)
 	}
 
 }
 
+// newSyncer sets up the syncer for conf and the flags
+func newSyncer() {
+	var err error
+	syncer, err = wpsync.New(conf)
+	if err != nil {
+		fatalf("Error in HTTP settings: %v", err)
+	}
+	syncer.Dryrun = dryrun
+	syncer.FailFast = failFast
+	if confirm {
+		syncer.Confirm = confirmPrompt
+	}
+	if output == outputJSON {
+		syncer.OnEvent = writeEvent
+	}
+}
+
 // route command and args
 func main() {
 
@@ -124,76 +205,85 @@ func main() {
 	// go test will always run init()
 	myInit()
 
-	// posts
-	localPosts := getLocalPosts()
-	if len(localPosts) > 0 {
-		remotePosts := getRemotePosts()
-		newPosts, updatedPosts := comparePosts(localPosts, remotePosts)
-		if !dryrun {
-			newPosts = loadPostsFromFiles(newPosts)
-			newPosts = createPosts(newPosts)
+	// interrupt cancels requests, the run stops after the
+	// current item and releases the lock
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-			updatedPosts = loadPostsFromFiles(updatedPosts)
-			updatedPosts = updatePosts(updatedPosts)
-
-			writeRemotePosts(newPosts, updatedPosts)
+	if command == "reconcile" {
+		if err := syncer.Reconcile(ctx); err != nil {
+			fatalf("Error reconciling with site: %v", err)
 		}
+		return
 	}
 
-	// pages
-	localPages := getLocalPages()
-	if len(localPages) > 0 {
-		remotePages := getRemotePages()
-		newPages, updatedPages := comparePages(localPages, remotePages)
-		if !dryrun {
-			newPages = loadPagesFromFiles(newPages)
-			newPages = createPages(newPages)
-
-			updatedPages = loadPagesFromFiles(updatedPages)
-			updatedPages = updatePages(updatedPages)
+	var summary wpsync.Summary
+	var err error
+	if command == "promote" {
+		log.Infof("Promoting %v to %v", promoteFrom, site)
+		summary, err = syncer.Promote(ctx, promoteFrom)
+	} else {
+		summary, err = syncer.Push(ctx)
+	}
+	finish(summary)
+	if err != nil {
+		fatalf("%v", err)
+	}
 
-			writeRemotePages(newPages, updatedPages)
+	// after a full sync, keep syncing files as they change
+	if command == "watch" {
+		if err := watch(ctx); err != nil {
+			fatalf("%v", err)
 		}
+		return
 	}
 
-	// media
-	localMedia := getLocalMedia()
-	if len(localMedia) > 0 {
-		remoteMedia := getRemoteMedia()
-		newMedia := compareMedia(localMedia, remoteMedia)
-
-		if !dryrun {
-			uploadedMedia := uploadMediaItems(newMedia)
-			writeRemoteMedia(uploadedMedia)
-		}
+	// non-zero exit so scripts and CI see failed items
+	if summary.Failed > 0 {
+		os.Exit(1)
 	}
 }
 
-func confirmPrompt(prompt string) bool {
+// fatalf logs the error and exits, releasing the lock
+func fatalf(format string, a ...interface{}) {
+	log.Errorf(format, a...)
+	if syncer != nil {
+		syncer.ReleaseLock() // exit skips deferred release
+	}
+	os.Exit(1)
+}
 
-	// confirmation not required
-	if !confirm {
-		return true
+// siteName returns the site name for messages
+func siteName(site string) string {
+	if site == "" {
+		return "default site"
 	}
+	return site
+}
 
-	var ans string
-	fmt.Print(prompt)
-	_, err := fmt.Scanln(&ans)
+func confirmPrompt(prompt string) bool {
+	ans, err := readLine(prompt)
 	if err != nil {
-		log.Fatal("What happened?", err)
-	}
-	if ans == "y" || ans == "Y" {
-		return true
-	} else {
-		return false
+		fatalf("%v", err)
 	}
+	return ans == "y" || ans == "Y"
 }
 
 // Display Usage
 func usage() {
-	fmt.Println("usage: wpsync [args]")
+	fmt.Println("usage: wpsync [args] [command]")
 	fmt.Println("Arguments:")
 	flag.PrintDefaults()
 	fmt.Println("")
+	fmt.Println("Commands:")
+	fmt.Println("  migrate")
+	fmt.Println("    \tConvert posts.json, pages.json and media.json to state file")
+	fmt.Println("  promote <from-site> <to-site>")
+	fmt.Println("    \tPush files synced and unchanged on one site to another")
+	fmt.Println("  reconcile")
+	fmt.Println("    \tRebuild state by matching local files to existing site items")
+	fmt.Println("  watch")
+	fmt.Println("    \tSync, then sync again each time a file is saved")
+	fmt.Println("")
 	os.Exit(0)
 }
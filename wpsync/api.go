@@ -0,0 +1,360 @@
+package wpsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// metaPathKey is the post meta key wpsync stores the local
+// path in, used by reconcile to match remote items
+const metaPathKey = "wpsync_path"
+
+// listPerPage is the page size used when listing items
+const listPerPage = 100
+
+// RemoteItem is a post, page or media item listed from the site
+type RemoteItem struct {
+	Id        int    `json:"id"`
+	Link      string `json:"link"`
+	Slug      string `json:"slug"`
+	Status    string `json:"status"`
+	Modified  string `json:"modified_gmt"`
+	SourceURL string `json:"source_url"`
+	Title     struct {
+		Raw      string `json:"raw"`
+		Rendered string `json:"rendered"`
+	} `json:"title"`
+	Meta         json.RawMessage `json:"meta"`
+	MediaDetails struct {
+		Filesize int64 `json:"filesize"`
+	} `json:"media_details"`
+}
+
+// Term is a category or tag
+type Term struct {
+	Id     int    `json:"id"`
+	Name   string `json:"name"`
+	Slug   string `json:"slug"`
+	Parent int    `json:"parent"`
+	Count  int    `json:"count"`
+}
+
+// User is the authenticated user
+type User struct {
+	Id           int             `json:"id"`
+	Name         string          `json:"name"`
+	Slug         string          `json:"slug"`
+	Roles        []string        `json:"roles"`
+	Capabilities map[string]bool `json:"capabilities"`
+}
+
+// Index is the REST API root, it lists the namespaces of
+// the core API and plugins such as jwt-auth/v1
+type Index struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Namespaces []string `json:"namespaces"`
+}
+
+// HasNamespace returns true if the API has the namespace
+func (i Index) HasNamespace(namespace string) bool {
+	for _, ns := range i.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// MetaValue returns a string meta value, meta is an empty
+// array rather than object when there are no values
+func (r RemoteItem) MetaValue(key string) string {
+	var meta map[string]interface{}
+	if err := json.Unmarshal(r.Meta, &meta); err != nil {
+		return ""
+	}
+	value, _ := meta[key].(string)
+	return value
+}
+
+// ModifiedTime parses the GMT modified date
+func (r RemoteItem) ModifiedTime() time.Time {
+	t, _ := time.Parse("2006-01-02T15:04:05", r.Modified)
+	return t
+}
+
+// call sends the request and decodes the JSON response into
+// v, a non-2xx response is returned as an error
+func (c *Client) call(ctx context.Context, req request, v interface{}) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(req, resp); err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Bytes, v)
+}
+
+// postParams are the fields sent when creating or updating a post
+func postParams(post Post) url.Values {
+	params := url.Values{}
+	params.Add("title", post.Title)
+	params.Add("date", post.Date)
+	params.Add("content", post.Content)
+	params.Add("status", post.Status)
+	if post.Path != "" {
+		params.Add("meta["+metaPathKey+"]", post.Path)
+	}
+	if post.SyncId != "" {
+		params.Add("meta["+metaIdKey+"]", post.SyncId)
+	}
+	params.Add("publicize", "0")
+	return params
+}
+
+// pageParams are the fields sent when creating or updating a page
+func pageParams(page Page) url.Values {
+	params := url.Values{}
+	params.Add("title", page.Title)
+	params.Add("content", page.Content)
+	params.Add("status", page.Status)
+	if page.Path != "" {
+		params.Add("meta["+metaPathKey+"]", page.Path)
+	}
+	if page.SyncId != "" {
+		params.Add("meta["+metaIdKey+"]", page.SyncId)
+	}
+
+	if page.Template != "" {
+		params.Add("template", page.Template)
+	}
+
+	if page.ParentId != 0 {
+		params.Add("parent", strconv.Itoa(page.ParentId))
+	}
+
+	if page.Order != "" {
+		params.Add("menu_order", page.Order)
+	}
+	return params
+}
+
+// CreatePost creates a new post
+func (c *Client) CreatePost(ctx context.Context, post Post) (Post, error) {
+	req := request{method: "POST", endpoint: "wp/v2/posts", params: postParams(post), create: true}
+	err := c.call(ctx, req, &post)
+	return post, err
+}
+
+// UpdatePost updates an existing post
+func (c *Client) UpdatePost(ctx context.Context, post Post) (Post, error) {
+	api := fmt.Sprintf("wp/v2/posts/%v", post.Id)
+	req := request{method: "POST", endpoint: api, params: postParams(post)}
+	err := c.call(ctx, req, &post)
+	return post, err
+}
+
+// CreatePage creates a new page
+func (c *Client) CreatePage(ctx context.Context, page Page) (Page, error) {
+	req := request{method: "POST", endpoint: "wp/v2/pages", params: pageParams(page), create: true}
+	err := c.call(ctx, req, &page)
+	return page, err
+}
+
+// UpdatePage updates an existing page
+func (c *Client) UpdatePage(ctx context.Context, page Page) (Page, error) {
+	api := fmt.Sprintf("wp/v2/pages/%v", page.Id)
+	req := request{method: "POST", endpoint: api, params: pageParams(page)}
+	err := c.call(ctx, req, &page)
+	return page, err
+}
+
+// UploadMedia uploads file with the metadata of media, and
+// returns media with the id and URLs of the upload
+func (c *Client) UploadMedia(ctx context.Context, file string, media Media) (Media, error) {
+	params := url.Values{}
+	media.Meta.addParams(params, false)
+	if media.ParentId != 0 {
+		params.Add("post", strconv.Itoa(media.ParentId))
+	}
+
+	var m Media
+	req := request{method: "POST", endpoint: "wp/v2/media", params: params, file: file, create: true}
+	if err := c.call(ctx, req, &m); err != nil {
+		return m, err
+	}
+
+	media.URL = m.URL
+	media.Link = m.Link
+	media.Id = m.Id
+	return media, nil
+}
+
+// UpdateMedia updates the metadata of an uploaded file
+func (c *Client) UpdateMedia(ctx context.Context, media Media) error {
+	params := url.Values{}
+	media.Meta.addParams(params, true)
+
+	api := fmt.Sprintf("wp/v2/media/%v", media.Id)
+	return c.call(ctx, request{method: "POST", endpoint: api, params: params}, nil)
+}
+
+// DeleteMedia deletes an uploaded file, media can not be
+// trashed so force is required
+func (c *Client) DeleteMedia(ctx context.Context, id int) error {
+	api := fmt.Sprintf("wp/v2/media/%v", id)
+	params := url.Values{"force": {"true"}}
+	return c.call(ctx, request{method: "DELETE", endpoint: api, params: params}, nil)
+}
+
+// ListPosts lists all posts matching the query
+func (c *Client) ListPosts(ctx context.Context, query url.Values) ([]RemoteItem, error) {
+	return c.list(ctx, "wp/v2/posts", query)
+}
+
+// ListPages lists all pages matching the query
+func (c *Client) ListPages(ctx context.Context, query url.Values) ([]RemoteItem, error) {
+	return c.list(ctx, "wp/v2/pages", query)
+}
+
+// ListMedia lists all media matching the query
+func (c *Client) ListMedia(ctx context.Context, query url.Values) ([]RemoteItem, error) {
+	return c.list(ctx, "wp/v2/media", query)
+}
+
+// ListTerms lists all terms of a taxonomy, categories or tags
+func (c *Client) ListTerms(ctx context.Context, taxonomy string) (terms []Term, err error) {
+	err = c.eachPage(ctx, "wp/v2/"+taxonomy, nil, func(data []byte) (int, error) {
+		var pageTerms []Term
+		if err := json.Unmarshal(data, &pageTerms); err != nil {
+			return 0, err
+		}
+		terms = append(terms, pageTerms...)
+		return len(pageTerms), nil
+	})
+	return terms, err
+}
+
+// Index returns the API root, it does not need a token so
+// can be used to check the site before logging in
+func (c *Client) Index(ctx context.Context) (Index, error) {
+	return c.indexAt(ctx, c.apiRoot())
+}
+
+// indexAt returns the API root at a url
+func (c *Client) indexAt(ctx context.Context, rootURL string) (idx Index, err error) {
+	err = c.call(ctx, request{method: "GET", url: rootURL, noAuth: true}, &idx)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return idx, errors.New("No REST API found, the response is not JSON")
+	}
+	if err != nil {
+		return idx, err
+	}
+	if len(idx.Namespaces) == 0 {
+		return idx, errors.New("No REST API found, the response is not from WordPress")
+	}
+	return idx, nil
+}
+
+// CurrentUser returns the user the token belongs to
+func (c *Client) CurrentUser(ctx context.Context) (user User, err error) {
+	params := url.Values{"context": {"edit"}}
+	err = c.call(ctx, request{method: "GET", endpoint: "wp/v2/users/me", params: params}, &user)
+	return user, err
+}
+
+// UploadLimit returns the largest file in bytes the site
+// accepts, from the block editor settings in WordPress 5.8+
+func (c *Client) UploadLimit(ctx context.Context) (int64, error) {
+	var settings struct {
+		MaxUploadFileSize int64 `json:"maxUploadFileSize"`
+	}
+	err := c.call(ctx, request{method: "GET", endpoint: "wp-block-editor/v1/settings"}, &settings)
+	if err == nil && settings.MaxUploadFileSize == 0 {
+		err = errors.New("No upload limit in block editor settings")
+	}
+	return settings.MaxUploadFileSize, err
+}
+
+// RequestToken asks the JWT plugin for a token
+func (c *Client) RequestToken(ctx context.Context, user, pass string) (string, error) {
+	params := url.Values{}
+	params.Add("username", user)
+	params.Add("password", pass)
+
+	var auth struct {
+		Token string `json:"token"`
+	}
+	req := request{method: "POST", endpoint: "jwt-auth/v1/token", params: params, noAuth: true}
+	if err := c.call(ctx, req, &auth); err != nil {
+		return "", err
+	}
+	if auth.Token == "" {
+		return "", errors.New("No authentication token in response")
+	}
+	return auth.Token, nil
+}
+
+// ValidateToken checks the token with the JWT plugin, or
+// for WordPress.com by fetching the current user
+func (c *Client) ValidateToken(ctx context.Context) error {
+	if c.WPComSite != "" {
+		return c.call(ctx, request{method: "GET", endpoint: "wp/v2/users/me"}, nil)
+	}
+	return c.call(ctx, request{method: "POST", endpoint: "jwt-auth/v1/token/validate"}, nil)
+}
+
+// list fetches all items for an endpoint
+func (c *Client) list(ctx context.Context, endpoint string, query url.Values) (items []RemoteItem, err error) {
+	err = c.eachPage(ctx, endpoint, query, func(data []byte) (int, error) {
+		var pageItems []RemoteItem
+		if err := json.Unmarshal(data, &pageItems); err != nil {
+			return 0, err
+		}
+		items = append(items, pageItems...)
+		return len(pageItems), nil
+	})
+	return items, err
+}
+
+// eachPage fetches each page of results for an endpoint until
+// a short page signals the end, add decodes a page and returns
+// the number of results in it
+func (c *Client) eachPage(ctx context.Context, endpoint string, query url.Values, add func([]byte) (int, error)) error {
+	for page := 1; ; page++ {
+		params := url.Values{}
+		for key, values := range query {
+			params[key] = values
+		}
+		params.Set("context", "edit")
+		params.Set("per_page", strconv.Itoa(listPerPage))
+		params.Set("page", strconv.Itoa(page))
+
+		req := request{method: "GET", endpoint: endpoint, params: params}
+		resp, err := c.send(ctx, req)
+		if err != nil {
+			return err
+		}
+		if err := checkResponse(req, resp); err != nil {
+			return err
+		}
+
+		n, err := add(resp.Bytes)
+		if err != nil {
+			return err
+		}
+		if n < listPerPage {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// bundleIndex is the markdown file of a post bundle, a
+// directory in posts with the post's images next to it
+const bundleIndex = "index.md"
+
+// isBundle returns true if the post file is a bundle index
+func isBundle(localFile string) bool {
+	return filepath.Base(localFile) == bundleIndex && filepath.Dir(localFile) != "."
+}
+
+// getLocalBundle returns the post for a bundle directory, its
+// ModDate is the latest of the index and the bundle media so
+// adding or changing an image updates the post
+func (s *Syncer) getLocalBundle(dir string) (post Post, ok bool) {
+	localFile := dir + "/" + bundleIndex // same as the state key
+	files, err := ioutil.ReadDir(s.path(stateKey(s.postsDir(), dir)))
+	if err != nil {
+		return post, false
+	}
+
+	for _, file := range files {
+		if file.Name() == bundleIndex {
+			ok = true
+		} else if !isMediaFile(file.Name()) {
+			continue
+		}
+		if file.ModTime().After(post.ModDate) {
+			post.ModDate = file.ModTime()
+		}
+	}
+	if !ok {
+		return post, false
+	}
+
+	post.LocalFile = localFile
+	post.SyncId = readSyncId(s.path(stateKey(s.postsDir(), localFile)))
+	return post, true
+}
+
+// getBundleMedia lists the media files in a bundle, by name,
+// dir is the bundle directory as a state key
+func (s *Syncer) getBundleMedia(dir string) (media []Media) {
+	files, err := ioutil.ReadDir(s.path(dir))
+	if err != nil {
+		log.Warnf("Error reading bundle directory %v: %v", dir, err)
+		return media
+	}
+	for _, file := range files {
+		if isMediaFile(file.Name()) {
+			m := Media{}
+			m.Dir = dir
+			m.LocalFile = file.Name()
+			m.Meta = getMediaMeta(s.path(dir), file.Name(), nil)
+			m.Hash = fileHash(s.path(s.mediaKey(m)))
+			media = append(media, m)
+		}
+	}
+	return media
+}
+
+// syncBundleMedia uploads new and changed bundle media attached
+// to the post, and returns all of the bundle media with URLs
+func (s *Syncer) syncBundleMedia(ctx context.Context, dir string, postId int) (media []Media, err error) {
+	state, err := s.loadState()
+	if err != nil {
+		return media, err
+	}
+	for _, m := range s.getBundleMedia(dir) {
+		key := stateKey(dir, m.LocalFile)
+		item, exists := state.Items[key]
+		if exists && (item.Hash == m.Hash || s.Config.mediaPolicy() == mediaPolicySkip) {
+			m.Id, m.URL, m.Link = item.Id, item.URL, item.Link
+			media = append(media, m)
+			continue
+		}
+
+		m.ParentId = postId
+		upm, err := s.uploadMedia(ctx, m)
+		if err != nil {
+			if err := s.fail(Event{Type: typeMedia, File: key, Action: "upload"}, err); err != nil {
+				return media, err
+			}
+			continue
+		}
+		upm.LocalFile, upm.Dir, upm.Meta = m.LocalFile, m.Dir, m.Meta
+		owned := exists && s.ownsMedia(key, item.Id)
+		if err := s.saveRemoteMedia(upm); err != nil {
+			if err := s.fail(Event{Type: typeMedia, File: key, Id: upm.Id, URL: upm.URL, Action: "save"}, err); err != nil {
+				return media, err
+			}
+			media = append(media, upm) // uploaded, so the post can use it
+			continue
+		}
+		log.Infof("Uploaded: %s %s", key, upm.URL)
+		s.record(Event{Event: "created", Type: typeMedia, File: key, Id: upm.Id, URL: upm.URL})
+
+		if owned && s.Config.mediaPolicy() == mediaPolicyReplace {
+			err := s.Client.DeleteMedia(ctx, item.Id)
+			if err != nil && !errors.Is(err, ErrDeleted) {
+				log.Warnf("Error deleting replaced media %v: %v", item.URL, err)
+			}
+		}
+		media = append(media, upm)
+	}
+	return media, nil
+}
+
+// syncBundle uploads the bundle media for a post, then points
+// relative references in the content at the uploads and adds
+// the gallery if the front matter asks for one
+func (s *Syncer) syncBundle(ctx context.Context, post Post) (Post, error) {
+	dir := stateKey(s.postsDir(), path.Dir(post.LocalFile))
+	media, err := s.syncBundleMedia(ctx, dir, post.Id)
+	if err != nil {
+		return post, err
+	}
+
+	post.Content = resolveBundleRefs(post.Content, media)
+	if post.Gallery != "" {
+		post.Content += galleryBlock(galleryMedia(post.Gallery, media))
+	}
+	return post, nil
+}
+
+// resolveBundleRefs replaces src and href attributes that name
+// a bundle file, such as src="beach.jpg", with the upload URL
+func resolveBundleRefs(content string, media []Media) string {
+	for _, m := range media {
+		if m.URL == "" {
+			continue
+		}
+		for _, attr := range []string{"src", "href"} {
+			for _, ref := range []string{m.LocalFile, "./" + m.LocalFile} {
+				old := fmt.Sprintf(`%s="%s"`, attr, ref)
+				content = strings.Replace(content, old, fmt.Sprintf(`%s="%s"`, attr, m.URL), -1)
+			}
+		}
+	}
+	return content
+}
+
+// galleryMedia picks the gallery images, gallery: true uses
+// all bundle images by name, otherwise a comma separated list
+func galleryMedia(gallery string, media []Media) (picked []Media) {
+	if gallery == "true" {
+		picked = append(picked, media...)
+		sort.Slice(picked, func(i, j int) bool { return picked[i].LocalFile < picked[j].LocalFile })
+		return picked
+	}
+
+	for _, name := range strings.Split(gallery, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, m := range media {
+			if m.LocalFile == name {
+				picked = append(picked, m)
+				found = true
+			}
+		}
+		if !found {
+			log.Warnf("Gallery image not in bundle: %v", name)
+		}
+	}
+	return picked
+}
+
+// galleryBlock returns the block editor markup for a gallery
+func galleryBlock(media []Media) string {
+	var b strings.Builder
+	b.WriteString("\n<!-- wp:gallery {\"linkTo\":\"none\"} -->\n")
+	b.WriteString("<figure class=\"wp-block-gallery has-nested-images columns-default is-cropped\">\n")
+	for _, m := range media {
+		if m.Id == 0 {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("<!-- wp:image {\"id\":%d,\"sizeSlug\":\"large\",\"linkDestination\":\"none\"} -->\n", m.Id))
+		b.WriteString(fmt.Sprintf("<figure class=\"wp-block-image size-large\"><img src=\"%s\" alt=\"%s\" class=\"wp-image-%d\"/></figure>\n",
+			html.EscapeString(m.URL), html.EscapeString(m.Meta.AltText), m.Id))
+		b.WriteString("<!-- /wp:image -->\n")
+	}
+	b.WriteString("</figure>\n<!-- /wp:gallery -->\n")
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package wpsync
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestBundle uploads bundle images attached to the new post,
+// then updates the post with resolved references and gallery
+func TestBundle(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("posts/trip", 0755)
+	ioutil.WriteFile("posts/trip/index.md", []byte("---\ntitle: Trip\ngallery: true\n---\n![Beach](beach.jpg)\n"), 0644)
+	ioutil.WriteFile("posts/trip/beach.jpg", []byte("jpg"), 0644)
+
+	var parent, content string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wp-json/wp/v2/posts":
+			fmt.Fprint(w, `{"id": 10, "link": "http://x/trip"}`)
+		case "/wp-json/wp/v2/media":
+			parent = r.FormValue("post")
+			fmt.Fprint(w, `{"id": 20, "source_url": "http://x/beach.jpg"}`)
+		case "/wp-json/wp/v2/posts/10":
+			content = r.FormValue("content")
+			fmt.Fprint(w, `{"id": 10, "link": "http://x/trip"}`)
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+
+	local := s.getLocalPosts()
+	if len(local) != 1 || local[0].LocalFile != "trip/index.md" {
+		t.Fatal("Bundle not found", local)
+	}
+
+	created, _ := s.createPosts(context.Background(), s.loadPostsFromFiles(local))
+	if len(created) != 1 {
+		t.Fatal("Bundle post not created")
+	}
+	if parent != "10" {
+		t.Error("Media not attached to post, got parent", parent)
+	}
+	if !strings.Contains(content, `src="http://x/beach.jpg"`) {
+		t.Error("Relative image not resolved", content)
+	}
+	if !strings.Contains(content, `<!-- wp:image {"id":20`) {
+		t.Error("Gallery block missing", content)
+	}
+	if stateOf(t, s).Items["posts/trip/beach.jpg"].Id != 20 {
+		t.Error("Bundle media not in state")
+	}
+}
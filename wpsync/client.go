@@ -0,0 +1,302 @@
+package wpsync
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Version of wpsync, sent in the User-Agent
+const Version = "0.2.0"
+
+// Client is a WordPress REST API client. All requests go
+// through it, so timeouts, retries, logging and the like are
+// set up in one place. HTTPClient can be replaced, tests use
+// it to inject a fake transport.
+type Client struct {
+	SiteURL string
+	Token   string
+
+	// APIRoot is the REST API root, SiteURL/wp-json/ if empty,
+	// or SiteURL/?rest_route=/ for sites without pretty permalinks
+	APIRoot string
+
+	// WPComSite sends requests for the site through the
+	// WordPress.com API, which is then the APIRoot
+	WPComSite string
+
+	UserAgent  string
+	HTTPClient *http.Client
+
+	// retry transient failures, see retry.go
+	Retries      int
+	RetryWait    time.Duration
+	RetryMaxWait time.Duration
+
+	// maximum requests per minute, 0 for no limit
+	RateLimit int
+
+	// Timeout limits each attempt of a request other than an
+	// upload, including reading the response, 0 for none
+	Timeout time.Duration
+
+	lastRequest time.Time
+}
+
+// Response is a completed API response with the body read
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Bytes      []byte
+}
+
+// request describes a single API call
+type request struct {
+	method   string
+	endpoint string     // path under the API root, may include a query
+	url      string     // absolute url, used instead of endpoint
+	params   url.Values // form values, or query for GET and DELETE
+	file     string     // path of file to upload, sent as multipart
+	noAuth   bool       // do not send the token
+	create   bool       // creates an item, see isRetryable
+}
+
+// NewClient returns a client for the site with defaults set
+func NewClient(siteURL, token string) *Client {
+	return &Client{
+		SiteURL:      strings.TrimSuffix(siteURL, "/"),
+		Token:        token,
+		UserAgent:    "wpsync/" + Version,
+		HTTPClient:   &http.Client{},
+		Retries:      defaultRetries,
+		RetryWait:    defaultRetryWait * time.Second,
+		RetryMaxWait: defaultRetryMaxWait * time.Second,
+		Timeout:      defaultTimeout * time.Second,
+	}
+}
+
+// NewClientFromConfig returns a client with the settings
+// from wpsync.json applied over the defaults
+func NewClientFromConfig(conf Config) (*Client, error) {
+	httpClient, err := newHTTPClient(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewClient(conf.SiteURL, conf.Token)
+	c.HTTPClient = httpClient
+	if conf.Retries != nil {
+		c.Retries = *conf.Retries
+	}
+	if conf.RetryWait > 0 {
+		c.RetryWait = time.Duration(conf.RetryWait) * time.Second
+	}
+	if conf.RetryMaxWait > 0 {
+		c.RetryMaxWait = time.Duration(conf.RetryMaxWait) * time.Second
+	}
+	if conf.Timeout > 0 {
+		c.Timeout = time.Duration(conf.Timeout) * time.Second
+	}
+	c.RateLimit = conf.RateLimit
+	c.APIRoot = conf.APIRoot
+	if conf.IsWPCom() {
+		c.APIRoot = conf.wpcomAPI()
+		c.WPComSite = wpcomSite(conf.SiteURL)
+	}
+	return c, nil
+}
+
+// send makes the request, retrying transient failures using
+// exponential backoff and honouring Retry-After when given
+func (c *Client) send(ctx context.Context, req request) (resp Response, err error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.throttle(ctx); err != nil {
+			return resp, err
+		}
+		resp, err = c.do(ctx, req)
+		if ctx.Err() != nil || !isRetryable(req.create, resp, err) || attempt >= c.Retries {
+			return resp, err
+		}
+
+		wait := c.backoff(attempt)
+		if ra := retryAfter(resp); ra > wait {
+			wait = ra
+		}
+		if wait > c.RetryMaxWait {
+			wait = c.RetryMaxWait
+		}
+
+		if err != nil {
+			log.Warnf("Request failed, retrying in %v: %v", wait, err)
+		} else {
+			log.Warnf("Request failed, retrying in %v status %v", wait, resp.StatusCode)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return resp, err
+		}
+	}
+}
+
+// do makes a single attempt of the request
+func (c *Client) do(ctx context.Context, req request) (resp Response, err error) {
+	// an upload may take longer, it is only limited by the
+	// response header timeout of the transport
+	if c.Timeout > 0 && req.file == "" {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	httpReq, err := c.newHTTPRequest(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+
+	log.Debugf("Request %v %v", req.method, httpReq.URL.String())
+	httpResp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+
+	resp.StatusCode = httpResp.StatusCode
+	resp.Header = httpResp.Header
+	resp.Bytes, err = ioutil.ReadAll(httpResp.Body)
+	return resp, err
+}
+
+// newHTTPRequest builds the http request, it is built again
+// for each attempt since a body can only be read once
+func (c *Client) newHTTPRequest(ctx context.Context, req request) (*http.Request, error) {
+	u := c.endpointURL(req.endpoint)
+	if req.url != "" {
+		u = req.url
+	}
+
+	var body io.Reader
+	contentType := ""
+	switch {
+	case req.file != "":
+		buf, ct, err := multipartBody(req.file, req.params)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = buf, ct
+	case req.method == "GET" || req.method == "DELETE":
+		if len(req.params) > 0 {
+			sep := "?"
+			if strings.Contains(u, "?") {
+				sep = "&"
+			}
+			u += sep + req.params.Encode()
+		}
+	default:
+		body = strings.NewReader(req.params.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" && !req.noAuth {
+		httpReq.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpReq.Header.Set("User-Agent", c.UserAgent)
+	return httpReq, nil
+}
+
+// apiRoot returns the API root, the default if not set
+func (c *Client) apiRoot() string {
+	if c.APIRoot != "" {
+		return c.APIRoot
+	}
+	return c.SiteURL + "/wp-json/"
+}
+
+// endpointURL returns the url of an endpoint, with a
+// ?rest_route= root the endpoint is part of the query
+func (c *Client) endpointURL(endpoint string) string {
+	if c.WPComSite != "" {
+		endpoint = wpcomEndpoint(endpoint, c.WPComSite)
+	}
+	root := c.apiRoot()
+	if !strings.Contains(root, "rest_route=") {
+		return root + endpoint
+	}
+	path, query := endpoint, ""
+	if i := strings.Index(endpoint, "?"); i >= 0 {
+		path, query = endpoint[:i], endpoint[i+1:]
+	}
+	u := root + path
+	if query != "" {
+		u += "&" + query
+	}
+	return u
+}
+
+// multipartBody builds a form with the file and params
+func multipartBody(filename string, params url.Values) (*bytes.Buffer, string, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	part, err := w.CreateFormFile("file", filepath.Base(filename))
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, "", err
+	}
+
+	for key, values := range params {
+		for _, value := range values {
+			if err := w.WriteField(key, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf, w.FormDataContentType(), nil
+}
+
+// throttle waits so requests do not exceed the RateLimit
+func (c *Client) throttle(ctx context.Context) error {
+	if c.RateLimit > 0 && !c.lastRequest.IsZero() {
+		interval := time.Minute / time.Duration(c.RateLimit)
+		if elapsed := time.Since(c.lastRequest); elapsed < interval {
+			if err := sleep(ctx, interval-elapsed); err != nil {
+				return err
+			}
+		}
+	}
+	c.lastRequest = time.Now()
+	return nil
+}
+
+// checkResponse returns an APIError for a non-2xx response
+func checkResponse(req request, resp Response) error {
+	if resp.StatusCode > 299 {
+		return newAPIError(req, resp)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package wpsync
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc is a fake transport for the client
+type roundTripFunc func(*http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r), nil
+}
+
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// TestClientTransport sends requests through an injected transport
+func TestClientTransport(t *testing.T) {
+	var reqs []*http.Request
+	c := NewClient("https://example.com/", "secret")
+	c.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+		r.ParseForm()
+		reqs = append(reqs, r)
+		return jsonResponse(201, `{"id": 7}`)
+	})}
+
+	post, err := c.CreatePost(context.Background(), Post{Title: "Hello", LocalFile: "hello.md", Path: "posts/hello.md"})
+	if err != nil {
+		t.Fatal("Error creating post", err)
+	}
+	if post.Id != 7 {
+		t.Error("Post id not set from response", post.Id)
+	}
+
+	r := reqs[0]
+	if r.Method != "POST" || r.URL.String() != "https://example.com/wp-json/wp/v2/posts" {
+		t.Error("Wrong request", r.Method, r.URL)
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		t.Error("Token not sent", r.Header.Get("Authorization"))
+	}
+	if r.Header.Get("User-Agent") != "wpsync/"+Version {
+		t.Error("User-Agent not set", r.Header.Get("User-Agent"))
+	}
+	if r.PostForm.Get("title") != "Hello" || r.PostForm.Get("meta[wpsync_path]") != "posts/hello.md" {
+		t.Error("Form not sent", r.PostForm)
+	}
+}
+
+// TestClientUpload sends the file as multipart form data
+func TestClientUpload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wpsync")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "photo.jpg")
+	ioutil.WriteFile(file, []byte("jpeg data"), 0644)
+
+	var content, name, alt string
+	c := NewClient("https://example.com", "")
+	c.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+		f, header, err := r.FormFile("file")
+		if err == nil {
+			data, _ := ioutil.ReadAll(f)
+			content, name = string(data), header.Filename
+		}
+		alt = r.FormValue("alt_text")
+		if r.Header.Get("Authorization") != "" {
+			t.Error("Authorization sent without token")
+		}
+		return jsonResponse(201, `{"id": 9, "source_url": "https://example.com/photo.jpg"}`)
+	})}
+
+	m := Media{LocalFile: "photo.jpg", Meta: MediaMeta{AltText: "A photo"}}
+	m, err := c.UploadMedia(context.Background(), file, m)
+	if err != nil {
+		t.Fatal("Error uploading", err)
+	}
+	if m.Id != 9 || m.URL != "https://example.com/photo.jpg" || m.LocalFile != "photo.jpg" {
+		t.Error("Media not set from response", m)
+	}
+	if content != "jpeg data" || name != "photo.jpg" || alt != "A photo" {
+		t.Error("Upload not sent as multipart", content, name, alt)
+	}
+}
+
+// TestCABundle trusts a server certificate from the CA bundle
+func TestCABundle(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1}`)
+	}))
+	defer ts.Close()
+
+	dir, _ := ioutil.TempDir("", "wpsync")
+	defer os.RemoveAll(dir)
+	bundle := filepath.Join(dir, "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}
+	ioutil.WriteFile(bundle, pem.EncodeToMemory(block), 0644)
+
+	c, err := NewClientFromConfig(Config{SiteURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Retries = 0
+	if _, err := c.CreatePost(context.Background(), Post{}); err == nil {
+		t.Error("Expected certificate error without CA bundle")
+	}
+
+	c, err = NewClientFromConfig(Config{SiteURL: ts.URL, CABundle: bundle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreatePost(context.Background(), Post{}); err != nil {
+		t.Error("Expected CA bundle to be trusted", err)
+	}
+
+	if _, err := NewClientFromConfig(Config{CABundle: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Error("Expected error for missing CA bundle")
+	}
+}
+
+// TestTimeout gives up on a server that does not respond
+func TestTimeout(t *testing.T) {
+	done := make(chan bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	c, err := NewClientFromConfig(Config{SiteURL: ts.URL, Timeout: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Retries = 0
+
+	start := time.Now()
+	if _, err := c.CreatePost(context.Background(), Post{}); err == nil {
+		t.Error("Expected timeout error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Timeout not applied")
+	}
+}
+
+// TestTimeoutBody gives up on a response that stops part way
+func TestTimeoutBody(t *testing.T) {
+	done := make(chan bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 1`)
+		w.(http.Flusher).Flush()
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	c, err := NewClientFromConfig(Config{SiteURL: ts.URL, Timeout: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Retries = 0
+
+	start := time.Now()
+	if _, err := c.ListPosts(context.Background(), nil); err == nil {
+		t.Error("Expected timeout error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Timeout not applied to the response body")
+	}
+}
+
+// TestIndex finds plugin namespaces and rejects non-API pages
+func TestIndex(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/wp-json/" {
+			fmt.Fprint(w, `{"name": "Blog", "namespaces": ["wp/v2", "jwt-auth/v1"]}`)
+			return
+		}
+		fmt.Fprint(w, `<html>Not WordPress</html>`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	idx, err := NewClient(ts.URL, "").Index(context.Background())
+	if err != nil || idx.Name != "Blog" || !idx.HasNamespace("jwt-auth/v1") {
+		t.Error("Expected index with jwt-auth", idx, err)
+	}
+	if _, err := NewClient(ts.URL+"/other", "").Index(context.Background()); err == nil {
+		t.Error("Expected error for a page that is not the API")
+	}
+}
+
+// TestRestRoute puts the endpoint and query in rest_route urls
+func TestRestRoute(t *testing.T) {
+	c := NewClient("https://example.com/blog", "")
+	if u := c.endpointURL("wp/v2/posts"); u != "https://example.com/blog/wp-json/wp/v2/posts" {
+		t.Error("Expected wp-json url, got", u)
+	}
+
+	c.APIRoot = "https://example.com/blog/?rest_route=/"
+	if u := c.endpointURL("wp/v2/posts/3?force=true"); u != "https://example.com/blog/?rest_route=/wp/v2/posts/3&force=true" {
+		t.Error("Expected rest_route url, got", u)
+	}
+
+	var got string
+	c.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) *http.Response {
+		got = r.URL.Query().Get("rest_route")
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`{"token":"t"}`)), Header: http.Header{}}
+	})}
+	if _, err := c.RequestToken(context.Background(), "u", "p"); err != nil || got != "/jwt-auth/v1/token" {
+		t.Error("Expected JWT route in rest_route, got", got, err)
+	}
+}
+
+// TestWPComEndpoint sends requests to the site on WordPress.com
+func TestWPComEndpoint(t *testing.T) {
+	c, err := NewClientFromConfig(Config{SiteURL: "https://example.wordpress.com", WPComAPI: "http://localhost:9000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := c.endpointURL("wp/v2/posts/3?force=true"); u != "http://localhost:9000/wp/v2/sites/example.wordpress.com/posts/3?force=true" {
+		t.Error("Expected WordPress.com site url, got", u)
+	}
+	if u := c.endpointURL(""); u != "http://localhost:9000/" {
+		t.Error("Expected API root, got", u)
+	}
+}
@@ -0,0 +1,195 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckStatus is the result of a diagnostic check
+type CheckStatus int
+
+const (
+	CheckPass CheckStatus = iota
+	CheckWarn
+	CheckFail
+)
+
+// Check is a line of the diagnostic checklist
+type Check struct {
+	Name   string
+	Status CheckStatus
+	Detail string
+}
+
+// Diagnose checks the config, REST API, authentication, user
+// capabilities and upload limit, and returns a checklist. It
+// stops at a failure that the later checks depend on.
+func (s *Syncer) Diagnose(ctx context.Context) (checks []Check) {
+	add := func(name string, status CheckStatus, format string, a ...interface{}) {
+		checks = append(checks, Check{Name: name, Status: status, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	if err := s.checkDirs(); err != nil {
+		add("Config", CheckFail, "%v", err)
+		return checks
+	}
+	if err := s.checkState(); err != nil {
+		add("Config", CheckFail, "%v", err)
+		return checks
+	}
+	if s.Config.SiteURL == "" {
+		add("Site URL", CheckFail, "not set, run wpsync --init")
+		return checks
+	}
+	add("Site URL", CheckPass, "%v", s.Config.SiteURL)
+
+	var dirs []string
+	for _, dir := range []string{s.postsDir(), s.pagesDir(), s.mediaDir()} {
+		if fi, err := os.Stat(s.path(dir)); err == nil && fi.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		add("Content", CheckWarn, "no %v, %v or %v directory found, nothing to sync", s.postsDir(), s.pagesDir(), s.mediaDir())
+	} else {
+		add("Content", CheckPass, "%v", strings.Join(dirs, ", "))
+	}
+
+	if s.Client.WPComSite != "" {
+		add("REST API", CheckPass, "WordPress.com site %v", s.Client.WPComSite)
+	} else if !s.checkAPI(ctx, add) {
+		return checks
+	}
+
+	if s.Config.Token == "" {
+		add("Token", CheckFail, "not set, run wpsync --init")
+		return checks
+	}
+	if err := s.Client.ValidateToken(ctx); err != nil {
+		add("Token", CheckFail, "%v", err)
+		return checks
+	}
+	add("Token", CheckPass, "valid")
+
+	user, err := s.Client.CurrentUser(ctx)
+	if err != nil {
+		add("User", CheckFail, "%v", err)
+		return checks
+	}
+	add("User", CheckPass, "%v (%v)", user.Name, strings.Join(user.Roles, ", "))
+
+	// capabilities needed for each content directory found
+	var missing []string
+	needs := []struct {
+		dir  string
+		caps []string
+	}{
+		{s.postsDir(), []string{"edit_posts", "publish_posts"}},
+		{s.pagesDir(), []string{"edit_pages", "publish_pages"}},
+		{s.mediaDir(), []string{"upload_files"}},
+	}
+	for _, need := range needs {
+		if !fileExists(s.path(need.dir)) {
+			continue
+		}
+		for _, capability := range need.caps {
+			if !user.Capabilities[capability] {
+				missing = append(missing, capability)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		add("Capabilities", CheckFail, "user lacks %v", strings.Join(missing, ", "))
+	} else {
+		add("Capabilities", CheckPass, "can publish the content found")
+	}
+
+	limit, err := s.Client.UploadLimit(ctx)
+	if err != nil {
+		add("Upload limit", CheckWarn, "unknown: %v", err)
+		return checks
+	}
+	file, size := s.largestMediaFile()
+	switch {
+	case size <= limit:
+		add("Upload limit", CheckPass, "%v, largest file is %v", formatSize(limit), formatSize(size))
+	case s.Config.ProcessImages:
+		add("Upload limit", CheckWarn, "%v is %v, over the %v limit unless process-images makes it smaller", file, formatSize(size), formatSize(limit))
+	default:
+		add("Upload limit", CheckFail, "%v is %v, over the %v limit", file, formatSize(size), formatSize(limit))
+	}
+	return checks
+}
+
+// checkAPI finds the REST API and the JWT plugin of a self
+// hosted site, it returns false if later checks can not run
+func (s *Syncer) checkAPI(ctx context.Context, add func(string, CheckStatus, string, ...interface{})) bool {
+	root, err := s.Client.DiscoverAPIRoot(ctx)
+	if err != nil {
+		add("REST API", CheckFail, "%v", err)
+		return false
+	}
+	switch {
+	case root == s.Client.apiRoot():
+		add("REST API", CheckPass, "%v", root)
+	case s.Client.APIRoot != "":
+		add("REST API", CheckWarn, "site reports %v but api-root is %v", root, s.Client.APIRoot)
+	default:
+		add("REST API", CheckPass, "%v, set api-root in wpsync.json to skip finding it", root)
+		s.Client.APIRoot = root
+	}
+
+	idx, err := s.Client.Index(ctx)
+	switch {
+	case err != nil:
+		add("JWT Auth plugin", CheckFail, "%v", err)
+		return false
+	case !idx.HasNamespace("jwt-auth/v1"):
+		add("JWT Auth plugin", CheckFail, "not found, install and activate jwt-authentication-for-wp-rest-api")
+		return false
+	}
+	add("JWT Auth plugin", CheckPass, "active")
+	return true
+}
+
+// Failed returns true if any check failed
+func Failed(checks []Check) bool {
+	for _, c := range checks {
+		if c.Status == CheckFail {
+			return true
+		}
+	}
+	return false
+}
+
+// largestMediaFile returns the largest media file, including
+// those in post bundles
+func (s *Syncer) largestMediaFile() (largest string, size int64) {
+	for _, dir := range []string{s.mediaDir(), s.postsDir()} {
+		filepath.Walk(s.path(dir), func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !fi.IsDir() && isMediaFile(fi.Name()) && fi.Size() > size {
+				largest, size = path, fi.Size()
+			}
+			return nil
+		})
+	}
+	return largest, size
+}
+
+// formatSize returns a byte count as MB or KB
+func formatSize(n int64) string {
+	if n >= 1<<20 {
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%d KB", (n+1023)/1024)
+}
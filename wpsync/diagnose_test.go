@@ -0,0 +1,83 @@
+package wpsync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// TestDiagnose reports a user who can not upload
+func TestDiagnose(t *testing.T) {
+	defer chdirTemp(t)()
+	os.MkdirAll("posts", 0755)
+	os.MkdirAll("media", 0755)
+
+	var ts *httptest.Server
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/wp-json/>; rel="https://api.w.org/"`, ts.URL))
+		case "/wp-json/":
+			fmt.Fprint(w, `{"name": "Blog", "namespaces": ["wp/v2", "jwt-auth/v1"]}`)
+		case "/wp-json/wp/v2/users/me":
+			fmt.Fprint(w, `{"name": "Ann", "roles": ["author"], "capabilities": {"edit_posts": true, "publish_posts": true}}`)
+		case "/wp-json/wp-block-editor/v1/settings":
+			fmt.Fprint(w, `{"maxUploadFileSize": 2097152}`)
+		}
+	}
+	ts = httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Config: Config{SiteURL: ts.URL, Token: "t"}, Client: NewClient(ts.URL, "t")}
+	checks := s.Diagnose(context.Background())
+
+	status := map[string]CheckStatus{}
+	for _, c := range checks {
+		status[c.Name] = c.Status
+	}
+	if status["REST API"] != CheckPass || status["Token"] != CheckPass || status["Upload limit"] != CheckPass {
+		t.Error("Expected API, token and upload limit to pass", checks)
+	}
+	if status["Capabilities"] != CheckFail || !Failed(checks) {
+		t.Error("Expected missing upload_files to fail", checks)
+	}
+}
+
+// TestAPILink parses the API root from Link headers
+func TestAPILink(t *testing.T) {
+	headers := []string{`<https://x/wp-json/wp/v2/pages/2>; rel="alternate"; type="application/json", <https://x/?rest_route=/>; rel="https://api.w.org/"`}
+	if root := apiLink(headers); root != "https://x/?rest_route=/" {
+		t.Error("Expected rest_route root, got", root)
+	}
+	if root := apiLink([]string{`<https://x/feed>; rel="alternate"`}); root != "" {
+		t.Error("Expected no root, got", root)
+	}
+}
+
+// TestCheckPlainPermalinks finds the rest_route API root when
+// /wp-json/ is not found
+func TestCheckPlainPermalinks(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("rest_route") {
+		case "/":
+			fmt.Fprint(w, `{"name": "Blog", "namespaces": ["wp/v2", "jwt-auth/v1"]}`)
+		case "/jwt-auth/v1/token/validate":
+			fmt.Fprint(w, `{"code": "jwt_auth_valid_token"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Config: Config{SiteURL: ts.URL, Token: "t"}, Client: NewClient(ts.URL, "t")}
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatal("Expected check to pass with rest_route", err)
+	}
+	if s.Client.APIRoot != ts.URL+"/?rest_route=/" {
+		t.Error("Expected rest_route API root, got", s.Client.APIRoot)
+	}
+}
@@ -0,0 +1,55 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// apiLinkRel is the rel of the Link header WordPress sends
+// with the API root on every page
+const apiLinkRel = "https://api.w.org/"
+
+// DiscoverAPIRoot finds the REST API root of the site, from
+// the Link header of the home page, or by trying /wp-json/
+// and then ?rest_route=/ for sites without pretty permalinks
+func (c *Client) DiscoverAPIRoot(ctx context.Context) (string, error) {
+	resp, err := c.send(ctx, request{method: "GET", url: c.SiteURL + "/", noAuth: true})
+	if err != nil {
+		return "", err
+	}
+	if root := apiLink(resp.Header.Values("Link")); root != "" {
+		log.Debugf("API root from Link header: %v", root)
+		return root, nil
+	}
+
+	for _, root := range []string{c.SiteURL + "/wp-json/", c.SiteURL + "/?rest_route=/"} {
+		_, err := c.indexAt(ctx, root)
+		if err == nil {
+			return root, nil
+		}
+		log.Debugf("No API at %v: %v", root, err)
+	}
+	return "", errors.New("No REST API found, is the URL right and the REST API enabled?")
+}
+
+// apiLink returns the API root from Link headers, such as
+// <https://example.com/wp-json/>; rel="https://api.w.org/"
+func apiLink(headers []string) string {
+	for _, header := range headers {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				if param == `rel="`+apiLinkRel+`"` || param == "rel="+apiLinkRel {
+					return strings.Trim(target, "<>")
+				}
+			}
+		}
+	}
+	return ""
+}
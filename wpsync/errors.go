@@ -0,0 +1,200 @@
+package wpsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// kinds of API errors, use errors.Is to check an APIError
+var (
+	ErrAuth        = errors.New("authentication failed")
+	ErrPermission  = errors.New("permission denied")
+	ErrNotFound    = errors.New("not found")
+	ErrValidation  = errors.New("invalid request")
+	ErrRateLimited = errors.New("rate limited")
+	ErrServer      = errors.New("server error")
+
+	// ErrDeleted is a not found for an item id the site says
+	// does not exist, unlike a missing route or a bare 404
+	// from a proxy, which may be a wrong URL
+	ErrDeleted = fmt.Errorf("deleted, %w", ErrNotFound)
+)
+
+// APIError is an error response from the REST API, parsed
+// from the WordPress error body when there is one
+type APIError struct {
+	StatusCode int
+	Code       string // e.g. rest_cannot_create
+	Message    string
+	Hint       string // what to do about it, may be empty
+	Kind       error
+	Params     map[string]string // invalid params and why
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("API Error [%v]", e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	msg += ": " + e.Message
+
+	keys := make([]string, 0, len(e.Params))
+	for key := range e.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		msg += fmt.Sprintf(" [%s: %s]", key, e.Params[key])
+	}
+
+	if e.Hint != "" {
+		msg += " (" + e.Hint + ")"
+	}
+	return msg
+}
+
+// Unwrap returns the kind so errors.Is(err, ErrAuth) works
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// restError is the body WordPress sends with an error
+type restError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Status int               `json:"status"`
+		Params map[string]string `json:"params"`
+	} `json:"data"`
+}
+
+// errorKinds maps error codes to a kind where the status
+// alone is misleading, the JWT plugin sends 403 for a bad token
+var errorKinds = map[string]error{
+	"jwt_auth_invalid_token":          ErrAuth,
+	"jwt_auth_bad_auth_header":        ErrAuth,
+	"jwt_auth_no_auth_header":         ErrAuth,
+	"jwt_auth_bad_config":             ErrAuth,
+	"[jwt_auth] incorrect_password":   ErrAuth,
+	"[jwt_auth] invalid_username":     ErrAuth,
+	"[jwt_auth] invalid_email":        ErrAuth,
+	"rest_not_logged_in":              ErrAuth,
+	"rest_no_route":                   ErrNotFound,
+	"rest_post_invalid_id":            ErrDeleted,
+	"rest_invalid_param":              ErrValidation,
+	"rest_missing_callback_param":     ErrValidation,
+	"rest_upload_file_too_big":        ErrValidation,
+	"rest_upload_user_quota_exceeded": ErrValidation,
+	"rest_upload_sideload_error":      ErrValidation,
+}
+
+// errorHints explain common errors, see errorHint for the
+// ones that depend on the endpoint
+var errorHints = map[string]string{
+	"jwt_auth_invalid_token":          "token invalid or expired, run wpsync --init",
+	"jwt_auth_bad_auth_header":        "token missing or malformed, run wpsync --init",
+	"jwt_auth_no_auth_header":         "Authorization header not passed to WordPress, check the .htaccess rewrite",
+	"jwt_auth_bad_config":             "JWT_AUTH_SECRET_KEY is not set in wp-config.php",
+	"[jwt_auth] incorrect_password":   "wrong username or password",
+	"[jwt_auth] invalid_username":     "wrong username or password",
+	"[jwt_auth] invalid_email":        "wrong username or password",
+	"rest_not_logged_in":              "token not accepted, check the .htaccess rewrite or run wpsync --init",
+	"rest_cannot_edit":                "user lacks edit_others_posts capability, or the item belongs to another user",
+	"rest_cannot_delete":              "user lacks delete capability for this item",
+	"rest_cannot_publish":             "user lacks publish capability, set status: draft or use an editor account",
+	"rest_cannot_edit_others":         "user lacks edit_others_posts capability",
+	"rest_cannot_assign_term":         "user lacks assign_terms capability",
+	"rest_no_route":                   "endpoint not found, check site-url and that the REST API is enabled",
+	"rest_post_invalid_id":            "item was deleted on the site",
+	"rest_upload_file_too_big":        "file is larger than the upload limit",
+	"rest_upload_user_quota_exceeded": "site storage quota exceeded",
+	"rest_upload_sideload_error":      "file type not allowed by the site",
+}
+
+// newAPIError returns the error for a non-2xx response to req
+func newAPIError(req request, resp Response) *APIError {
+	e := &APIError{StatusCode: resp.StatusCode}
+
+	var body restError
+	if err := json.Unmarshal(resp.Bytes, &body); err == nil && body.Code != "" {
+		e.Code = body.Code
+		e.Message = html.UnescapeString(stripTags(body.Message))
+		e.Params = body.Data.Params
+	} else {
+		// not from WordPress, such as a proxy error page
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+
+	e.Kind = errorKind(e.Code, e.StatusCode)
+	e.Hint = errorHint(e.Code, e.StatusCode, req.endpoint)
+	return e
+}
+
+// errorKind picks the kind by code, then by status
+func errorKind(code string, status int) error {
+	if kind, ok := errorKinds[code]; ok {
+		return kind
+	}
+	switch {
+	case status == http.StatusUnauthorized:
+		return ErrAuth
+	case status == http.StatusForbidden:
+		return ErrPermission
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return ErrNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status >= 500:
+		return ErrServer
+	}
+	return ErrValidation
+}
+
+// errorHint returns a hint for the error, the capability
+// needed to create depends on what is being created
+func errorHint(code string, status int, endpoint string) string {
+	if code == "rest_cannot_create" {
+		switch {
+		case strings.HasPrefix(endpoint, "wp/v2/pages"):
+			return "user lacks publish_pages capability"
+		case strings.HasPrefix(endpoint, "wp/v2/media"):
+			return "user lacks upload_files capability"
+		}
+		return "user lacks publish_posts capability"
+	}
+	if hint, ok := errorHints[code]; ok {
+		return hint
+	}
+
+	switch status {
+	case http.StatusUnauthorized:
+		return "run wpsync --init to log in again"
+	case http.StatusRequestEntityTooLarge:
+		return "file is larger than the server allows, check upload_max_filesize"
+	case http.StatusTooManyRequests:
+		return "rate limited by the server, set rate-limit in wpsync.json"
+	}
+	return ""
+}
+
+// stripTags removes html tags, some messages include links
+func stripTags(s string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
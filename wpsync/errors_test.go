@@ -0,0 +1,117 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAPIError parses WordPress error bodies into kinds
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		status   int
+		body     string
+		kind     error
+		hint     string
+	}{
+		{"wp/v2/posts", 403, `{"code":"rest_cannot_create","message":"Sorry, you are not allowed to create posts as this user.","data":{"status":403}}`, ErrPermission, "publish_posts"},
+		{"wp/v2/media", 401, `{"code":"rest_cannot_create","message":"Sorry","data":{"status":401}}`, ErrAuth, "upload_files"},
+		{"wp/v2/posts/9", 403, `{"code":"jwt_auth_invalid_token","message":"Expired token","data":{"status":403}}`, ErrAuth, "wpsync --init"},
+		{"wp/v2/posts/9", 404, `{"code":"rest_post_invalid_id","message":"Invalid post ID.","data":{"status":404}}`, ErrDeleted, "deleted"},
+		{"wp/v2/posts/9", 404, `{"code":"rest_no_route","message":"No route was found","data":{"status":404}}`, ErrNotFound, "endpoint"},
+		{"wp/v2/posts", 400, `{"code":"rest_invalid_param","message":"Invalid parameter(s): status","data":{"status":400,"params":{"status":"status is not one of publish, draft."}}}`, ErrValidation, ""},
+		{"wp/v2/media", 413, `<html>Request Entity Too Large</html>`, ErrValidation, "upload_max_filesize"},
+		{"wp/v2/posts", 429, ``, ErrRateLimited, "rate-limit"},
+		{"wp/v2/posts", 500, `<html>Error</html>`, ErrServer, ""},
+	}
+
+	for _, tt := range tests {
+		err := checkResponse(request{endpoint: tt.endpoint}, Response{StatusCode: tt.status, Bytes: []byte(tt.body)})
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("%s %d: expected %v, got %v", tt.endpoint, tt.status, tt.kind, err)
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatal("Expected APIError", err)
+		}
+		if !strings.Contains(apiErr.Hint, tt.hint) {
+			t.Errorf("%s %d: hint %q missing %q", tt.endpoint, tt.status, apiErr.Hint, tt.hint)
+		}
+	}
+
+	err := checkResponse(request{}, Response{StatusCode: 400, Bytes: []byte(`{"code":"rest_invalid_param","message":"Invalid parameter(s): status","data":{"params":{"status":"not allowed"}}}`)})
+	if !strings.Contains(err.Error(), "[status: not allowed]") {
+		t.Error("Invalid params not in message", err)
+	}
+}
+
+// TestUpdateDeletedPost creates a post again when it was
+// deleted on the site
+func TestUpdateDeletedPost(t *testing.T) {
+	defer chdirTemp(t)()
+
+	var calls []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		if r.URL.Path == "/wp-json/wp/v2/posts/5" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":"rest_post_invalid_id","message":"Invalid post ID.","data":{"status":404}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": 6, "link": "https://example.com/?p=6"}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+
+	updated, _ := s.updatePosts(context.Background(), []Post{{Id: 5, LocalFile: "gone.md"}})
+	if len(updated) != 1 || updated[0].Id != 6 {
+		t.Error("Expected post created again", updated)
+	}
+	if len(calls) != 2 || calls[1] != "/wp-json/wp/v2/posts" {
+		t.Error("Expected update then create", calls)
+	}
+	if item := stateOf(t, s).Items["posts/gone.md"]; item.Id != 6 {
+		t.Error("State not updated with new id", item)
+	}
+}
+
+// TestUpdateNotFound fails an update on a missing route or a
+// bare 404, which may be a wrong URL, without creating again
+func TestUpdateNotFound(t *testing.T) {
+	for _, body := range []string{
+		`{"code":"rest_no_route","message":"No route was found matching the URL and request method.","data":{"status":404}}`,
+		`<html>Not Found</html>`,
+	} {
+		func() {
+			defer chdirTemp(t)()
+
+			var calls []string
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, body)
+			}
+			ts := httptest.NewServer(http.HandlerFunc(handler))
+			defer ts.Close()
+			s := &Syncer{Client: NewClient(ts.URL, "")}
+			s.saveStateItem("posts/kept.md", StateItem{Type: typePost, Id: 5})
+
+			updated, _ := s.updatePosts(context.Background(), []Post{{Id: 5, LocalFile: "kept.md"}})
+			if len(updated) != 0 || s.Summary.Failed != 1 {
+				t.Error("Expected update failed", updated, s.Summary.Failed)
+			}
+			if len(calls) != 1 {
+				t.Error("Expected no create, got", calls)
+			}
+			if item := stateOf(t, s).Items["posts/kept.md"]; item.Id != 5 {
+				t.Error("State changed", item)
+			}
+		}()
+	}
+}
@@ -0,0 +1,216 @@
+package wpsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// defaults used when not set in wpsync.json
+const (
+	defaultImageMaxSize = 2048 // pixels, longest side
+	defaultImageQuality = 85   // jpeg quality 1-100
+)
+
+// processImage prepares a JPEG or PNG for upload, applying
+// the EXIF orientation, resizing to the max size and encoding
+// again, which also drops EXIF data including GPS location.
+// The processed copy is written to a temp directory with the
+// same name, cleanup removes it; the original is not changed.
+func processImage(filename string, conf Config) (processed string, cleanup func(), err error) {
+	cleanup = func() {}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		return filename, cleanup, nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return filename, cleanup, err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return filename, cleanup, err
+	}
+
+	img = resizeImage(img, conf.imageMaxSize())
+	if format == "jpeg" {
+		img = orientImage(img, exifOrientation(data))
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: conf.imageQuality()})
+	case "png":
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		err = enc.Encode(&buf, img)
+	default:
+		return filename, cleanup, nil
+	}
+	if err != nil {
+		return filename, cleanup, err
+	}
+
+	dir, err := ioutil.TempDir("", "wpsync-")
+	if err != nil {
+		return filename, cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	processed = filepath.Join(dir, filepath.Base(filename))
+	if err := ioutil.WriteFile(processed, buf.Bytes(), 0644); err != nil {
+		cleanup()
+		return filename, func() {}, err
+	}
+	log.Debugf("Processed image %v %v to %v bytes", filename, len(data), len(buf.Bytes()))
+	return processed, cleanup, nil
+}
+
+func (conf Config) imageMaxSize() int {
+	if conf.ImageMaxSize > 0 {
+		return conf.ImageMaxSize
+	}
+	return defaultImageMaxSize
+}
+
+func (conf Config) imageQuality() int {
+	if conf.ImageQuality > 0 && conf.ImageQuality <= 100 {
+		return conf.ImageQuality
+	}
+	return defaultImageQuality
+}
+
+// resizeImage scales the image so its longest side is at
+// most max pixels, smaller images are returned as is
+func resizeImage(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= max && h <= max {
+		return img
+	}
+
+	if w >= h {
+		h = h * max / w
+		w = max
+	} else {
+		w = w * max / h
+		h = max
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// orientImage rotates and flips the image so it displays
+// upright for EXIF orientation values 2 through 8
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontal
+				sx, sy = w-1-x, y
+			case 3: // rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertical
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90 counter clockwise
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// exifOrientation reads the orientation tag from the EXIF
+// segment of JPEG data, 1 (upright) when not found
+func exifOrientation(data []byte) int {
+	const orientationTag = 0x0112
+
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// walk the segments to find APP1 with the Exif header
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			return 1 // start of scan, no more metadata
+		}
+
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			tiff := segment[6:]
+			if len(tiff) < 8 {
+				return 1
+			}
+
+			var order binary.ByteOrder = binary.BigEndian
+			if string(tiff[:2]) == "II" {
+				order = binary.LittleEndian
+			}
+
+			ifd := int(order.Uint32(tiff[4:]))
+			if ifd+2 > len(tiff) {
+				return 1
+			}
+			count := int(order.Uint16(tiff[ifd:]))
+			for e := 0; e < count; e++ {
+				entry := ifd + 2 + e*12
+				if entry+12 > len(tiff) {
+					return 1
+				}
+				if order.Uint16(tiff[entry:]) == orientationTag {
+					return int(order.Uint16(tiff[entry+8:]))
+				}
+			}
+			return 1
+		}
+		i += 2 + size
+	}
+	return 1
+}
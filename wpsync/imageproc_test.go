@@ -0,0 +1,89 @@
+package wpsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOrientImage rotates a wide image to tall for orientation 6
+func TestOrientImage(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(0, 0, color.White) // top left
+
+	out := orientImage(img, 6)
+	if out.Bounds().Dx() != 2 || out.Bounds().Dy() != 4 {
+		t.Fatal("Expected 2x4, got", out.Bounds())
+	}
+	// rotating clockwise moves top left to top right
+	if r, _, _, _ := out.At(1, 0).RGBA(); r == 0 {
+		t.Error("Top left pixel not at top right after rotate")
+	}
+}
+
+// TestProcessImage resizes, strips EXIF and leaves the original
+func TestProcessImage(t *testing.T) {
+	defer chdirTemp(t)()
+
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 400, 200)), nil)
+	data := withExifOrientation(buf.Bytes(), 6)
+	if exifOrientation(data) != 6 {
+		t.Fatal("EXIF orientation not read")
+	}
+	ioutil.WriteFile("photo.jpg", data, 0644)
+
+	processed, cleanup, err := processImage("photo.jpg", Config{ImageMaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if filepath.Base(processed) != "photo.jpg" || processed == "photo.jpg" {
+		t.Error("Expected copy with same name, got", processed)
+	}
+	out, _ := ioutil.ReadFile(processed)
+	if exifOrientation(out) != 1 {
+		t.Error("EXIF not stripped")
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(out))
+	if err != nil || cfg.Width != 50 || cfg.Height != 100 {
+		t.Error("Expected rotated and resized 50x100, got", cfg.Width, cfg.Height, err)
+	}
+	if orig, _ := ioutil.ReadFile("photo.jpg"); !bytes.Equal(orig, data) {
+		t.Error("Original changed")
+	}
+
+	cleanup()
+	if _, err := os.Stat(processed); !os.IsNotExist(err) {
+		t.Error("Processed copy not removed")
+	}
+}
+
+// withExifOrientation inserts an APP1 Exif segment holding
+// only the orientation tag after the JPEG start marker
+func withExifOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1}
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3) // short
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0) // no next ifd
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
@@ -0,0 +1,127 @@
+package wpsync
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Level is the minimum level of messages written, the zero
+// value is LevelInfo
+type Level int
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+// ANSI colors for each level
+var levelColors = map[Level]string{
+	LevelDebug: "\033[36m", // cyan
+	LevelInfo:  "\033[32m", // green
+	LevelWarn:  "\033[33m", // yellow
+	LevelError: "\033[31m", // red
+}
+
+const colorReset = "\033[0m"
+
+// Logger writes leveled messages to stderr, and to a log
+// file when one is set, which gets every level
+type Logger struct {
+	Level      Level
+	Out        io.Writer // defaults to stderr
+	Color      bool
+	Timestamps bool
+	File       io.Writer
+}
+
+// log is used for all messages, see SetLogger
+var log = NewLogger()
+
+// NewLogger returns a logger for stderr, color is used on
+// a terminal unless NO_COLOR is set
+func NewLogger() *Logger {
+	return &Logger{
+		Color: isTerminal(os.Stderr) && os.Getenv("NO_COLOR") == "",
+	}
+}
+
+// SetLogger sets the logger used for all messages
+func SetLogger(l *Logger) {
+	log = l
+}
+
+// isTerminal returns true if f is a terminal, not a pipe or file
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// OpenLogFile appends messages of every level to filename
+func (l *Logger) OpenLogFile(filename string) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.File = f
+	return nil
+}
+
+func (l Logger) out() io.Writer {
+	if l.Out == nil {
+		return os.Stderr
+	}
+	return l.Out
+}
+
+// logf formats a message and writes it to each output
+func (l Logger) logf(level Level, format string, a ...interface{}) {
+	msg := strings.TrimRight(fmt.Sprintf(format, a...), "\n")
+	now := time.Now()
+
+	if level >= l.Level {
+		label := fmt.Sprintf("%-5s", levelNames[level])
+		if l.Color {
+			label = levelColors[level] + label + colorReset
+		}
+		line := label + " " + msg
+		if l.Timestamps {
+			line = now.Format(time.RFC3339) + " " + line
+		}
+		fmt.Fprintln(l.out(), line)
+	}
+
+	if l.File != nil {
+		fmt.Fprintf(l.File, "%s %-5s %s\n", now.Format(time.RFC3339), levelNames[level], msg)
+	}
+}
+
+func (l Logger) Debugf(format string, a ...interface{}) {
+	l.logf(LevelDebug, format, a...)
+}
+
+func (l Logger) Infof(format string, a ...interface{}) {
+	l.logf(LevelInfo, format, a...)
+}
+
+func (l Logger) Warnf(format string, a ...interface{}) {
+	l.logf(LevelWarn, format, a...)
+}
+
+func (l Logger) Errorf(format string, a ...interface{}) {
+	l.logf(LevelError, format, a...)
+}
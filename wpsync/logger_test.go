@@ -0,0 +1,36 @@
+package wpsync
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestLogger filters by level and formats printf style
+func TestLogger(t *testing.T) {
+	var out, file bytes.Buffer
+	l := Logger{Level: LevelWarn, Out: &out, File: &file}
+
+	l.Infof("Uploaded: %s", "photo.jpg")
+	l.Warnf("Error reading %s: %v", "posts", "denied")
+
+	if out.String() != "WARN  Error reading posts: denied\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	// the file gets every level with a timestamp
+	lines := strings.Split(strings.TrimSpace(file.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], " INFO  Uploaded: photo.jpg") {
+		t.Errorf("Unexpected log file %q", file.String())
+	}
+	if strings.Contains(file.String(), "\033[") {
+		t.Error("Color codes in log file")
+	}
+
+	out.Reset()
+	l.Color = true
+	l.Errorf("failed")
+	if !strings.HasPrefix(out.String(), levelColors[LevelError]) {
+		t.Errorf("Expected color %q", out.String())
+	}
+}
@@ -0,0 +1,451 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// media-policy settings for a media file changed after upload
+const (
+	mediaPolicySkip    = "skip"    // leave the uploaded file as is
+	mediaPolicyKeep    = "keep"    // upload new file, keep the old one
+	mediaPolicyReplace = "replace" // upload new file, delete the old one
+)
+
+// mediaPolicy returns the configured media-policy, keep is
+// the default so changes reach the site without losing files
+func (conf Config) mediaPolicy() string {
+	switch conf.MediaPolicy {
+	case "":
+		return mediaPolicyKeep
+	case mediaPolicySkip, mediaPolicyKeep, mediaPolicyReplace:
+		return conf.MediaPolicy
+	}
+	log.Warnf("Unknown media-policy %v using %v", conf.MediaPolicy, mediaPolicyKeep)
+	return mediaPolicyKeep
+}
+
+// getLocalMedia reads media from local directory, files left
+// out of the run are skipped before hashing
+func (s *Syncer) getLocalMedia() (media []Media) {
+	files, err := ioutil.ReadDir(s.path(s.mediaDir()))
+	if err != nil {
+		log.Infof("Error reading directory: %v", err)
+	}
+	index := s.readMediaIndex()
+	for _, file := range files {
+		if isMediaFile(file.Name()) {
+			m := Media{}
+			m.LocalFile = file.Name()
+			if s.filter != nil && !s.filter(s.mediaKey(m)) {
+				continue
+			}
+			m.Meta = getMediaMeta(s.path(s.mediaDir()), file.Name(), index)
+			m.Hash = fileHash(s.path(s.mediaKey(m)))
+			media = append(media, m)
+		}
+	}
+	return media
+}
+
+// mediaKey returns the state key of a media file, in media
+// unless it belongs to a post bundle
+func (s *Syncer) mediaKey(m Media) string {
+	if m.Dir != "" {
+		return stateKey(m.Dir, m.LocalFile)
+	}
+	return stateKey(s.mediaDir(), m.LocalFile)
+}
+
+// isMediaFile returns true for the image types uploaded,
+// sidecar metadata files are skipped
+func isMediaFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// getRemoteMedia reads uploaded media from state
+func (s *Syncer) getRemoteMedia() (media []Media, err error) {
+	files, items, err := s.stateItems(typeMedia, s.mediaDir())
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		media = append(media, Media{
+			Id:        item.Id,
+			URL:       item.URL,
+			Link:      item.Link,
+			MetaHash:  item.MetaHash,
+			Hash:      item.Hash,
+			LocalFile: files[i],
+		})
+	}
+	return media, nil
+}
+
+// compareMedia returns local media to upload, new files and
+// files changed since upload, and uploaded media whose sidecar
+// metadata has changed
+func (s *Syncer) compareMedia(local, remote []Media) (newMedia, updateMedia []Media) {
+	for _, m := range local {
+		exists := false
+		for _, r := range remote {
+			if m.LocalFile == r.LocalFile {
+				exists = true
+				changed := r.Hash != "" && m.Hash != r.Hash
+				if changed && s.Config.mediaPolicy() != mediaPolicySkip {
+					log.Debugf("File changed %v", m.LocalFile)
+					m.PrevId = r.Id
+					m.PrevURL = r.URL
+					newMedia = append(newMedia, m)
+					continue
+				}
+				if changed {
+					log.Warnf("Skipping changed file %v media-policy is %v", m.LocalFile, mediaPolicySkip)
+					s.record(Event{Event: "skipped", Type: typeMedia, File: s.mediaKey(m), Id: r.Id, URL: r.URL})
+				}
+
+				m.Id = r.Id
+				m.URL = r.URL
+				m.Link = r.Link
+				if m.Meta.Hash() != r.MetaHash {
+					log.Debugf("Metadata changed %v", m.LocalFile)
+					updateMedia = append(updateMedia, m)
+				} else if !changed {
+					log.Debugf("Skipping %v", m.LocalFile)
+					s.record(Event{Event: "skipped", Type: typeMedia, File: s.mediaKey(m), Id: r.Id, URL: r.URL})
+				}
+			}
+		}
+		if !exists {
+			newMedia = append(newMedia, m)
+		}
+	}
+	return newMedia, updateMedia
+}
+
+// uploadMedia uploads a single file, processing it first
+// when process-images is set
+func (s *Syncer) uploadMedia(ctx context.Context, media Media) (Media, error) {
+	file := s.path(s.mediaKey(media))
+	if s.Config.ProcessImages {
+		processed, cleanup, err := processImage(file, s.Config)
+		if err != nil {
+			return media, err
+		}
+		defer cleanup()
+		file = processed
+	}
+	return s.Client.UploadMedia(ctx, file, media)
+}
+
+func (s *Syncer) uploadMediaItems(ctx context.Context, media []Media) (uploadedMedia []Media, err error) {
+	for _, m := range media {
+		if s.confirm(fmt.Sprintf("Upload %s, Continue (y/N)? ", m.LocalFile)) {
+			// new files already in the library are linked, not uploaded
+			if m.PrevId == 0 {
+				if known, ok := s.findKnownMedia(ctx, m); ok {
+					linked, err := s.linkMedia(ctx, known)
+					if err != nil {
+						return uploadedMedia, err
+					}
+					if linked {
+						uploadedMedia = append(uploadedMedia, known)
+					}
+					continue
+				}
+			}
+
+			upm, err := s.uploadMedia(ctx, m)
+			if err != nil {
+				if err := s.fail(Event{Type: typeMedia, File: s.mediaKey(m), Action: "upload"}, err); err != nil {
+					return uploadedMedia, err
+				}
+				continue
+			}
+
+			upm.LocalFile = m.LocalFile
+			upm.Meta = m.Meta
+			upm.PrevURL = m.PrevURL
+			owned := m.PrevId != 0 && s.ownsMedia(s.mediaKey(m), m.PrevId)
+			if err := s.saveRemoteMedia(upm); err != nil {
+				if err := s.fail(Event{Type: typeMedia, File: s.mediaKey(m), Id: upm.Id, URL: upm.URL, Action: "save"}, err); err != nil {
+					return uploadedMedia, err
+				}
+				continue
+			}
+			log.Infof("Uploaded: %s %s", m.LocalFile, upm.URL)
+			s.record(Event{Event: "created", Type: typeMedia, File: s.mediaKey(m), Id: upm.Id, URL: upm.URL})
+			if m.PrevId != 0 {
+				s.replacedMedia(ctx, m, owned)
+			}
+			uploadedMedia = append(uploadedMedia, upm)
+		}
+	}
+	return uploadedMedia, nil
+}
+
+// findKnownMedia looks for a new local file already uploaded,
+// first by content hash in state, then in the remote library
+// by file name and size. Returns m with the remote ids set.
+func (s *Syncer) findKnownMedia(ctx context.Context, m Media) (Media, bool) {
+	key := s.mediaKey(m)
+	if m.Hash != "" {
+		state, err := s.loadState()
+		if err != nil {
+			log.Warnf("%v", err)
+			return m, false
+		}
+		for k, item := range state.Items {
+			if item.Type == typeMedia && item.Hash == m.Hash && k != key {
+				log.Debugf("Same content as %v", k)
+				m.Id, m.URL, m.Link, m.Linked = item.Id, item.URL, item.Link, true
+				return m, true
+			}
+		}
+	}
+
+	fi, err := os.Stat(s.path(key))
+	if err != nil {
+		return m, false
+	}
+
+	stem := strings.TrimSuffix(m.LocalFile, filepath.Ext(m.LocalFile))
+	items, err := s.Client.ListMedia(ctx, url.Values{"search": {stem}})
+	if err != nil {
+		log.Warnf("Error searching media library: %v", err)
+		return m, false
+	}
+	for _, r := range items {
+		if r.MediaDetails.Filesize == fi.Size() && mediaNameMatches(r.SourceURL, m.LocalFile) {
+			m.Id, m.URL, m.Link, m.Linked = r.Id, r.SourceURL, r.Link, true
+			return m, true
+		}
+	}
+	return m, false
+}
+
+// mediaNameMatches compares a remote file to a local name,
+// allowing for the -1 and -scaled suffixes WordPress adds
+func mediaNameMatches(remoteURL, filename string) bool {
+	remote := path.Base(remoteURL)
+	ext := strings.ToLower(path.Ext(remote))
+	if ext != strings.ToLower(filepath.Ext(filename)) {
+		return false
+	}
+
+	local := slugify(strings.TrimSuffix(filename, filepath.Ext(filename)))
+	remote = slugify(strings.TrimSuffix(remote, path.Ext(remote)))
+	remote = strings.TrimSuffix(remote, "-scaled")
+	if remote == local {
+		return true
+	}
+
+	// strip a numeric suffix added for duplicate names
+	if i := strings.LastIndex(remote, "-"); i > 0 {
+		if _, err := strconv.Atoi(remote[i+1:]); err == nil {
+			return remote[:i] == local
+		}
+	}
+	return false
+}
+
+// linkMedia records a known attachment for a local file and
+// sends its sidecar metadata, false if either failed so the
+// file is linked again next sync
+func (s *Syncer) linkMedia(ctx context.Context, m Media) (bool, error) {
+	if m.Meta.Hash() != "" {
+		if err := s.Client.UpdateMedia(ctx, m); err != nil {
+			return false, s.fail(Event{Type: typeMedia, File: s.mediaKey(m), Id: m.Id, URL: m.URL, Action: "update"}, err)
+		}
+	}
+	if err := s.saveRemoteMedia(m); err != nil {
+		return false, s.fail(Event{Type: typeMedia, File: s.mediaKey(m), Id: m.Id, URL: m.URL, Action: "save"}, err)
+	}
+	log.Infof("Linked: %s %s", m.LocalFile, m.URL)
+	s.record(Event{Event: "linked", Type: typeMedia, File: s.mediaKey(m), Id: m.Id, URL: m.URL})
+	return true, nil
+}
+
+// replacedMedia marks posts and pages linking to an earlier
+// upload of a changed file to update, and deletes the old
+// upload if configured and owned, see ownsMedia
+func (s *Syncer) replacedMedia(ctx context.Context, prev Media, owned bool) {
+	s.markReferences(s.mediaKey(prev))
+
+	if s.Config.mediaPolicy() != mediaPolicyReplace {
+		return
+	}
+	if !owned {
+		log.Infof("Keeping replaced media %v, it was not uploaded for %v or another file uses it", prev.PrevURL, prev.LocalFile)
+		return
+	}
+	err := s.Client.DeleteMedia(ctx, prev.PrevId)
+	if errors.Is(err, ErrDeleted) {
+		log.Debugf("Replaced media already deleted: %v", prev.PrevURL)
+	} else if err != nil {
+		log.Warnf("Error deleting replaced media %v: %v", prev.PrevURL, err)
+	} else {
+		log.Infof("Deleted replaced media: %v", prev.PrevURL)
+	}
+}
+
+// markReferences clears the sync date of synced posts and
+// pages whose markdown links to an earlier upload of the media
+// file key, so they update on this sync. The markdown keeps
+// the URL it was written with, which may be any earlier upload,
+// and is not changed, the link is replaced when the content is
+// sent, see resolveMediaURLs, as the new URL is only right for
+// this site.
+func (s *Syncer) markReferences(key string) {
+	state, err := s.loadState()
+	if err != nil {
+		log.Warnf("Error marking media references: %v", err)
+		return
+	}
+	prevURLs := state.Items[key].PrevURLs
+	for k, item := range state.Items {
+		if item.Type != typePost && item.Type != typePage {
+			continue
+		}
+		data, err := ioutil.ReadFile(s.path(k))
+		if err != nil || !containsAny(string(data), prevURLs) {
+			continue
+		}
+		item.SyncDate = time.Time{}
+		if err := s.saveStateItem(k, item); err != nil {
+			log.Warnf("Error marking media reference in %v: %v", k, err)
+		} else {
+			log.Infof("Media reference to update in %v", k)
+		}
+	}
+}
+
+// containsAny returns true if s contains any of subs
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if sub != "" && strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveMediaURLs replaces links to earlier uploads of
+// changed media with their current URL on this site
+func (s *Syncer) resolveMediaURLs(content string) string {
+	state, err := s.loadState()
+	if err != nil {
+		return content
+	}
+	keys := make([]string, 0, len(state.Items))
+	for key := range state.Items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		item := state.Items[key]
+		for _, u := range item.PrevURLs {
+			pairs = append(pairs, u, item.URL)
+		}
+	}
+	if len(pairs) == 0 {
+		return content
+	}
+	return strings.NewReplacer(pairs...).Replace(content)
+}
+
+// updateMediaItems sends changed sidecar metadata for media
+// already uploaded, the file itself is not uploaded again
+func (s *Syncer) updateMediaItems(ctx context.Context, media []Media) (updatedMedia []Media, err error) {
+	for _, m := range media {
+		if s.confirm(fmt.Sprintf("Update metadata %s, Continue (y/N)? ", m.LocalFile)) {
+			action := "update"
+			err := s.Client.UpdateMedia(ctx, m)
+			if err == nil {
+				action = "save"
+				err = s.saveRemoteMedia(m)
+			} else if errors.Is(err, ErrDeleted) {
+				// deleted in the media library
+				log.Warnf("Media not found on site, it will be uploaded again next sync: %v", m.LocalFile)
+				action = "save"
+				if err = s.removeStateItem(s.mediaKey(m)); err == nil {
+					continue
+				}
+			}
+			if err != nil {
+				if err := s.fail(Event{Type: typeMedia, File: s.mediaKey(m), Action: action}, err); err != nil {
+					return updatedMedia, err
+				}
+				continue
+			}
+			log.Infof("Updated metadata: %s %s", m.LocalFile, m.URL)
+			s.record(Event{Event: "updated", Type: typeMedia, File: s.mediaKey(m), Id: m.Id, URL: m.URL})
+			updatedMedia = append(updatedMedia, m)
+		}
+	}
+	return updatedMedia, nil
+}
+
+// ownsMedia returns true if the attachment id was uploaded for
+// the file key and no other file uses it, so it may be deleted
+// when the file is replaced. Call before saving the new upload.
+func (s *Syncer) ownsMedia(key string, id int) bool {
+	state, err := s.loadState()
+	if err != nil {
+		return false
+	}
+	if item := state.Items[key]; item.Id != id || item.Linked {
+		return false
+	}
+	for k, item := range state.Items {
+		if k != key && item.Id == id {
+			return false
+		}
+	}
+	return true
+}
+
+// saveRemoteMedia records an uploaded file in state,
+// called after each upload so progress is kept
+func (s *Syncer) saveRemoteMedia(m Media) error {
+	key := s.mediaKey(m)
+	state, err := s.loadState()
+	if err != nil {
+		return err
+	}
+	prev := state.Items[key]
+	prevURLs := prev.PrevURLs
+	if m.PrevURL != "" && m.PrevURL != m.URL {
+		prevURLs = append(prevURLs, m.PrevURL)
+	}
+	// still linked when only the metadata is updated
+	linked := m.Linked || prev.Linked && prev.Id == m.Id
+	return s.saveStateItem(key, StateItem{
+		Type:     typeMedia,
+		Id:       m.Id,
+		URL:      m.URL,
+		Link:     m.Link,
+		ModDate:  fileModDate(s.path(key)),
+		SyncDate: time.Now(),
+		Hash:     fileHash(s.path(key)),
+		MetaHash: m.Meta.Hash(),
+		PrevURLs: prevURLs,
+		Linked:   linked,
+	})
+}
@@ -0,0 +1,230 @@
+package wpsync
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestChangedMedia uploads a changed file, updates posts linking
+// to it without changing the markdown and with replace policy
+// deletes the old attachment
+func TestChangedMedia(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("media", 0755)
+	os.MkdirAll("posts", 0755)
+	ioutil.WriteFile("media/a.jpg", []byte("edited"), 0644)
+	ioutil.WriteFile("posts/ref.md", []byte("![A](http://x/old-a.jpg)"), 0644)
+	os.MkdirAll("posts/trip", 0755)
+	ioutil.WriteFile("posts/trip/index.md", []byte("![A](http://x/old-a.jpg)"), 0644)
+	(&Syncer{}).saveStateItem("media/a.jpg", StateItem{Type: typeMedia, Id: 1, URL: "http://x/old-a.jpg", Hash: "old"})
+	(&Syncer{}).saveStateItem("posts/ref.md", StateItem{Type: typePost, Id: 3, SyncDate: time.Now()})
+	(&Syncer{}).saveStateItem("posts/trip/index.md", StateItem{Type: typePost, Id: 4, SyncDate: time.Now()})
+
+	deleted := ""
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deleted = r.URL.Path
+		}
+		fmt.Fprint(w, `{"id": 2, "source_url": "http://x/new-a.jpg"}`)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+	s.Config.MediaPolicy = mediaPolicyReplace
+	defer func() { s.Config.MediaPolicy = "" }()
+
+	remote, _ := s.getRemoteMedia()
+	newMedia, _ := s.compareMedia(s.getLocalMedia(), remote)
+	if len(newMedia) != 1 || newMedia[0].PrevId != 1 {
+		t.Fatal("Changed file not detected", newMedia)
+	}
+	s.uploadMediaItems(context.Background(), newMedia)
+
+	state := stateOf(t, s)
+	for _, f := range []string{"posts/ref.md", "posts/trip/index.md"} {
+		data, _ := ioutil.ReadFile(f)
+		if string(data) != "![A](http://x/old-a.jpg)" {
+			t.Error("Markdown changed in", f, string(data))
+		}
+		if !state.Items[f].SyncDate.IsZero() {
+			t.Error("Post linking to old media not marked to update", f)
+		}
+	}
+	if content := s.readParseFile("ref.md").Content; !strings.Contains(content, "http://x/new-a.jpg") {
+		t.Error("Link not replaced in content sent, got", content)
+	}
+	if deleted != "/wp-json/wp/v2/media/1" {
+		t.Error("Old media not deleted, got", deleted)
+	}
+	if state.Items["media/a.jpg"].Id != 2 {
+		t.Error("State not updated to new upload")
+	}
+}
+
+// TestDedupeMedia links new files already uploaded instead of
+// uploading them again, by state hash or remote name and size
+func TestDedupeMedia(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("media", 0755)
+	ioutil.WriteFile("media/copy.jpg", []byte("same"), 0644)
+	ioutil.WriteFile("media/Admin Upload.jpg", []byte("12345"), 0644)
+	(&Syncer{}).saveStateItem("media/orig.jpg", StateItem{Type: typeMedia, Id: 1, URL: "http://x/orig.jpg", Hash: fileHash("media/copy.jpg")})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Error("Expected no upload, got", r.Method, r.URL)
+		}
+		fmt.Fprint(w, `[{"id": 5, "source_url": "http://x/uploads/admin-upload-1.jpg", "media_details": {"filesize": 5}}]`)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+
+	remote, _ := s.getRemoteMedia()
+	newMedia, _ := s.compareMedia(s.getLocalMedia(), remote)
+
+	// declined files are not linked either
+	s.Confirm = func(string) bool { return false }
+	linked, _ := s.uploadMediaItems(context.Background(), newMedia)
+	if len(linked) != 0 || len(stateOf(t, s).Items) != 1 {
+		t.Fatal("Expected declined media not linked, got", linked)
+	}
+
+	s.Confirm = nil
+	linked, _ = s.uploadMediaItems(context.Background(), newMedia)
+	if len(linked) != 2 {
+		t.Fatal("Expected 2 linked media, got", len(linked))
+	}
+
+	state := stateOf(t, s)
+	if state.Items["media/copy.jpg"].Id != 1 || !state.Items["media/copy.jpg"].Linked {
+		t.Error("Copy not linked by hash", state.Items)
+	}
+	if state.Items["media/Admin Upload.jpg"].Id != 5 {
+		t.Error("Upload not linked by name and size", state.Items)
+	}
+}
+
+// TestLinkMediaFailure counts a file whose metadata can not be
+// sent as failed only, and links it again next sync
+func TestLinkMediaFailure(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("media", 0755)
+	ioutil.WriteFile("media/copy.jpg", []byte("same"), 0644)
+	ioutil.WriteFile("media/copy.jpg.yml", []byte("alt_text: Copy\n"), 0644)
+	(&Syncer{}).saveStateItem("media/orig.jpg", StateItem{Type: typeMedia, Id: 1, URL: "http://x/orig.jpg", Hash: fileHash("media/copy.jpg")})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"code":"rest_invalid_param","message":"Invalid parameter(s): alt_text"}`)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+
+	remote, _ := s.getRemoteMedia()
+	newMedia, _ := s.compareMedia(s.getLocalMedia(), remote)
+	linked, _ := s.uploadMediaItems(context.Background(), newMedia)
+	if len(linked) != 0 || s.Summary.Failed != 1 || s.Summary.Linked != 0 {
+		t.Error("Expected failed and not linked", linked, s.Summary)
+	}
+	if _, ok := stateOf(t, s).Items["media/copy.jpg"]; ok {
+		t.Error("Failed link saved in state")
+	}
+}
+
+// TestReplaceSharedMedia keeps a replaced attachment that another
+// file uses, or that was linked and not uploaded
+func TestReplaceSharedMedia(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("media", 0755)
+	ioutil.WriteFile("media/a.jpg", []byte("edited a"), 0644)
+	ioutil.WriteFile("media/b.jpg", []byte("same"), 0644)
+	ioutil.WriteFile("media/c.jpg", []byte("edited c"), 0644)
+	(&Syncer{}).saveStateItem("media/a.jpg", StateItem{Type: typeMedia, Id: 11, URL: "http://x/a.jpg", Hash: fileHash("media/b.jpg")})
+	(&Syncer{}).saveStateItem("media/b.jpg", StateItem{Type: typeMedia, Id: 11, URL: "http://x/a.jpg", Hash: fileHash("media/b.jpg"), Linked: true})
+	(&Syncer{}).saveStateItem("media/c.jpg", StateItem{Type: typeMedia, Id: 12, URL: "http://x/admin-c.jpg", Hash: "old", Linked: true})
+
+	var deleted []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deleted = append(deleted, r.URL.Path)
+		}
+		fmt.Fprint(w, `{"id": 20, "source_url": "http://x/new.jpg"}`)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+	s.Config.MediaPolicy = mediaPolicyReplace
+
+	remote, _ := s.getRemoteMedia()
+	newMedia, _ := s.compareMedia(s.getLocalMedia(), remote)
+	if len(newMedia) != 2 {
+		t.Fatal("Expected a.jpg and c.jpg changed, got", newMedia)
+	}
+	s.uploadMediaItems(context.Background(), newMedia)
+
+	if len(deleted) != 0 {
+		t.Error("Shared or linked media deleted", deleted)
+	}
+	state := stateOf(t, s)
+	if state.Items["media/b.jpg"].Id != 11 || state.Items["media/c.jpg"].Linked {
+		t.Error("State wrong after replace", state.Items)
+	}
+}
+
+// TestChangedMediaTwice marks a post linking to the first upload
+// when the file changes a second time
+func TestChangedMediaTwice(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("media", 0755)
+	os.MkdirAll("posts", 0755)
+	ioutil.WriteFile("posts/ref.md", []byte("![A](http://x/a1.jpg)"), 0644)
+	(&Syncer{}).saveStateItem("media/a.jpg", StateItem{Type: typeMedia, Id: 1, URL: "http://x/a1.jpg", Hash: "old"})
+
+	id := 1
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id++
+		fmt.Fprintf(w, `{"id": %d, "source_url": "http://x/a%d.jpg"}`, id, id)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+	for _, content := range []string{"edit 1", "edit 2"} {
+		ioutil.WriteFile("media/a.jpg", []byte(content), 0644)
+		s.saveStateItem("posts/ref.md", StateItem{Type: typePost, Id: 5, SyncDate: time.Now()})
+
+		remote, _ := s.getRemoteMedia()
+		newMedia, _ := s.compareMedia(s.getLocalMedia(), remote)
+		s.uploadMediaItems(context.Background(), newMedia)
+
+		if !stateOf(t, s).Items["posts/ref.md"].SyncDate.IsZero() {
+			t.Error("Post linking to first upload not marked after", content)
+		}
+	}
+	if content := s.readParseFile("ref.md").Content; !strings.Contains(content, "http://x/a3.jpg") {
+		t.Error("Link not replaced with latest upload, got", content)
+	}
+}
@@ -0,0 +1,109 @@
+package wpsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mediaIndexFile holds metadata for many files in the media
+// directory, a sidecar such as photo.jpg.yml is for one file
+const (
+	mediaIndexFile = "media.yml"
+	sidecarExt     = ".yml"
+)
+
+// MediaMeta is the attachment metadata read from sidecars
+type MediaMeta struct {
+	AltText     string
+	Caption     string
+	Title       string
+	Description string
+}
+
+// Hash returns a hash of the metadata used to detect changes,
+// empty when there is no metadata
+func (mm MediaMeta) Hash() string {
+	if mm == (MediaMeta{}) {
+		return ""
+	}
+	s := strings.Join([]string{mm.AltText, mm.Caption, mm.Title, mm.Description}, "\x00")
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// addParams adds the metadata to the request params, empty
+// values are only sent when clearing a previous value
+func (mm MediaMeta) addParams(params url.Values, clear bool) {
+	fields := map[string]string{
+		"alt_text":    mm.AltText,
+		"caption":     mm.Caption,
+		"title":       mm.Title,
+		"description": mm.Description,
+	}
+	for key, value := range fields {
+		if value != "" || clear {
+			params.Add(key, value)
+		}
+	}
+}
+
+// readMediaIndex reads media.yml, a section per file name
+// with the metadata fields below it
+func (s *Syncer) readMediaIndex() map[string]map[string]string {
+	index := map[string]map[string]string{}
+	readMetaFile(s.path(stateKey(s.mediaDir(), mediaIndexFile)), &index)
+	return index
+}
+
+// readSidecar reads the metadata fields of a sidecar file
+func readSidecar(filename string) map[string]string {
+	fields := map[string]string{}
+	readMetaFile(filename, &fields)
+	return fields
+}
+
+// readMetaFile unmarshals a YAML metadata file into v, a
+// missing file is skipped and an invalid one warned about
+func readMetaFile(filename string, v interface{}) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	if err := yaml.Unmarshal(data, v); err != nil {
+		log.Warnf("Error reading media metadata %v: %v", filename, err)
+	}
+}
+
+// getMediaMeta returns metadata for a file in dir from the
+// index, with fields in the file's own sidecar taking priority
+func getMediaMeta(dir, filename string, index map[string]map[string]string) (mm MediaMeta) {
+	fields := map[string]string{}
+	for key, value := range index[filename] {
+		fields[key] = value
+	}
+	for key, value := range readSidecar(filepath.Join(dir, filename+sidecarExt)) {
+		fields[key] = value
+	}
+
+	for key, value := range fields {
+		switch key {
+		case "alt_text":
+			mm.AltText = value
+		case "caption":
+			mm.Caption = value
+		case "title":
+			mm.Title = value
+		case "description":
+			mm.Description = value
+		default:
+			log.Warnf("Unknown media metadata %v for %v", key, filename)
+		}
+	}
+	return mm
+}
@@ -0,0 +1,77 @@
+package wpsync
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// TestMediaMeta reads the index and lets a sidecar override it
+func TestMediaMeta(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("media", 0755)
+	ioutil.WriteFile("media/a.jpg", []byte("a"), 0644)
+	ioutil.WriteFile("media/b.jpg", []byte("b"), 0644)
+	ioutil.WriteFile("media/media.yml", []byte("a.jpg:\n  alt_text: From index\n  caption: Index caption\nb.jpg:\n  title: \"B title\"\n  description: |\n    Line one\n    Line two\n"), 0644)
+	ioutil.WriteFile("media/a.jpg.yml", []byte("# sidecar\nalt_text: 'From sidecar: a'\n"), 0644)
+
+	s := &Syncer{}
+	media := s.getLocalMedia()
+	if len(media) != 2 {
+		t.Fatal("Expected 2 media files, sidecars excluded, got", len(media))
+	}
+
+	a, b := media[0].Meta, media[1].Meta
+	if a.AltText != "From sidecar: a" || a.Caption != "Index caption" {
+		t.Error("Sidecar should override index", a)
+	}
+	if b.Title != "B title" || b.Description != "Line one\nLine two\n" {
+		t.Error("Index metadata not read", b)
+	}
+
+	// changed metadata on uploaded media is an update
+	remote := []Media{
+		{Id: 1, LocalFile: "a.jpg", MetaHash: a.Hash()},
+		{Id: 2, LocalFile: "b.jpg", MetaHash: "old"},
+	}
+	newMedia, updateMedia := s.compareMedia(media, remote)
+	if len(newMedia) != 0 || len(updateMedia) != 1 || updateMedia[0].Id != 2 {
+		t.Error("Expected only b.jpg metadata update", newMedia, updateMedia)
+	}
+}
+
+// TestUploadMediaMeta sends the metadata with the upload
+func TestUploadMediaMeta(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("media", 0755)
+	ioutil.WriteFile("media/a.jpg", []byte("a"), 0644)
+
+	var altText string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		altText = r.FormValue("alt_text")
+		fmt.Fprint(w, `{"id": 3, "source_url": "http://x/a.jpg"}`)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+
+	m := Media{LocalFile: "a.jpg", Meta: MediaMeta{AltText: "Alt"}}
+	uploaded, _ := s.uploadMediaItems(context.Background(), []Media{m})
+	if len(uploaded) != 1 {
+		t.Fatal("Expected upload")
+	}
+	if altText != "Alt" {
+		t.Error("alt_text not sent, got", altText)
+	}
+	if stateOf(t, s).Items["media/a.jpg"].MetaHash != m.Meta.Hash() {
+		t.Error("Metadata hash not saved in state")
+	}
+}
@@ -0,0 +1,118 @@
+package wpsync
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// legacy state files, replaced by the state file
+var legacyStateFiles = []string{"posts.json", "pages.json", "media.json"}
+
+// NeedsMigration returns true when legacy state files exist
+// but the state file has not been created from them yet. The
+// legacy files are the state of the default site, so it is
+// the default site state file checked for any site.
+func (s *Syncer) NeedsMigration() bool {
+	if _, err := os.Stat(s.path(statePath(""))); err == nil {
+		return false
+	}
+	for _, f := range legacyStateFiles {
+		if _, err := os.Stat(s.path(f)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateState converts posts.json, pages.json and media.json
+// into the state file of the default site, the legacy files
+// are left in place
+func (s *Syncer) MigrateState() error {
+	if s.Config.Site != "" {
+		return errors.New("posts.json, pages.json and media.json are the state of the default site, run migrate without --site")
+	}
+	if err := s.start(); err != nil {
+		return err
+	}
+	defer s.ReleaseLock()
+
+	if _, err := os.Stat(s.stateFile()); err == nil {
+		log.Infof("%v already exists, nothing to migrate", s.stateFile())
+		return nil
+	}
+
+	state := State{Version: stateVersion, Items: map[string]StateItem{}}
+
+	var posts []Post
+	if err := s.readLegacyFile("posts.json", &posts); err != nil {
+		return err
+	}
+	for _, p := range posts {
+		key := stateKey(s.postsDir(), p.LocalFile)
+		state.Items[key] = StateItem{
+			Type:     typePost,
+			Id:       p.Id,
+			URL:      p.URL,
+			Status:   p.Status,
+			ModDate:  fileModDate(s.path(key)),
+			SyncDate: p.SyncDate,
+			Hash:     fileHash(s.path(key)),
+		}
+	}
+
+	var pages []Page
+	if err := s.readLegacyFile("pages.json", &pages); err != nil {
+		return err
+	}
+	for _, p := range pages {
+		key := stateKey(s.pagesDir(), p.LocalFile)
+		state.Items[key] = StateItem{
+			Type:     typePage,
+			Id:       p.Id,
+			URL:      p.URL,
+			Status:   p.Status,
+			ModDate:  fileModDate(s.path(key)),
+			SyncDate: p.SyncDate,
+			Hash:     fileHash(s.path(key)),
+		}
+	}
+
+	var media []Media
+	if err := s.readLegacyFile("media.json", &media); err != nil {
+		return err
+	}
+	for _, m := range media {
+		key := stateKey(s.mediaDir(), m.LocalFile)
+		state.Items[key] = StateItem{
+			Type:    typeMedia,
+			Id:      m.Id,
+			URL:     m.URL,
+			Link:    m.Link,
+			ModDate: fileModDate(s.path(key)),
+			Hash:    fileHash(s.path(key)),
+		}
+	}
+
+	if err := s.writeState(state); err != nil {
+		return err
+	}
+	log.Infof("Migrated %v posts, %v pages, %v media to %v", len(posts), len(pages), len(media), s.stateFile())
+	log.Infof("The old posts.json, pages.json and media.json files can be removed")
+	return nil
+}
+
+// readLegacyFile unmarshals a legacy json file into v,
+// a missing file is not an error
+func (s *Syncer) readLegacyFile(filename string, v interface{}) error {
+	file, err := ioutil.ReadFile(s.path(filename))
+	if os.IsNotExist(err) {
+		log.Debugf("%v does not exist, skipping", filename)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(file, v)
+}
@@ -0,0 +1,261 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imdario/mergo"
+	"gopkg.in/russross/blackfriday.v2"
+)
+
+// getLocalPages reads  from local directory
+func (s *Syncer) getLocalPages() (pages []Page) {
+	files, err := ioutil.ReadDir(s.path(s.pagesDir()))
+	if err != nil {
+		log.Infof("Error reading pages directory: %v", err)
+	}
+	for _, file := range files {
+		if strings.Contains(file.Name(), ".md") {
+			log.Debugf("Pages file name: %v", file.Name())
+			page := Page{}
+			page.LocalFile = file.Name()
+			page.SyncId = readSyncId(s.path(stateKey(s.pagesDir(), file.Name())))
+			page.ModDate = file.ModTime()
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// getRemotePages reads synced pages from state
+func (s *Syncer) getRemotePages() (pages []Page, err error) {
+	files, items, err := s.stateItems(typePage, s.pagesDir())
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		pages = append(pages, Page{
+			Id:        item.Id,
+			URL:       item.URL,
+			Status:    item.Status,
+			SyncId:    item.SyncId,
+			LocalFile: files[i],
+			SyncDate:  item.SyncDate,
+		})
+	}
+	return pages, nil
+}
+
+// comparePages returns local pages that do not exist in remote
+func (s *Syncer) comparePages(local, remote []Page) (newPages, updatePages []Page) {
+	for _, lp := range local {
+		exists := false
+		for _, rp := range remote {
+			renamed := lp.LocalFile != rp.LocalFile && lp.SyncId != "" && lp.SyncId == rp.SyncId
+			if renamed && fileExists(s.path(stateKey(s.pagesDir(), rp.LocalFile))) {
+				// both files exist, so a copy not a rename
+				log.Warnf("Skipping %v same %v as %v remove it from the copy", lp.LocalFile, metaIdKey, rp.LocalFile)
+				s.record(Event{Event: "skipped", Type: typePage, File: stateKey(s.pagesDir(), lp.LocalFile)})
+				exists = true
+				continue
+			}
+			if lp.LocalFile == rp.LocalFile || renamed {
+				exists = true
+				lp.Id = rp.Id // set Id from remote
+				if renamed {
+					log.Infof("Renamed page: %s to %s", rp.LocalFile, lp.LocalFile)
+					lp.PrevFile = rp.LocalFile
+					updatePages = append(updatePages, lp)
+				} else if lp.ModDate.After(rp.SyncDate) {
+					log.Debugf("Local File: %v", lp.LocalFile)
+					log.Debugf("Local ModDate  : %v", lp.ModDate.Unix())
+					log.Debugf("Remote SyncDate: %v", rp.SyncDate.Unix())
+					updatePages = append(updatePages, lp)
+				} else {
+					log.Debugf("Skipping %v", lp.LocalFile)
+					s.record(Event{Event: "skipped", Type: typePage, File: stateKey(s.pagesDir(), lp.LocalFile), Id: rp.Id, URL: rp.URL})
+				}
+			}
+		}
+		if !exists {
+			newPages = append(newPages, lp)
+		}
+	}
+	return newPages, updatePages
+}
+
+// createPages loops through pages and uploads
+// pages are returned with Id/Url set
+func (s *Syncer) createPages(ctx context.Context, newPages []Page) (createdPages []Page, err error) {
+	for _, p := range newPages {
+		if s.confirm(fmt.Sprintf("New page %s, Continue (y/N)? ", p.LocalFile)) {
+			p.SyncId = s.ensureSyncId(s.path(stateKey(s.pagesDir(), p.LocalFile)), p.SyncId)
+			p.Path = stateKey(s.pagesDir(), p.LocalFile)
+			rp, err := s.Client.CreatePage(ctx, p)
+			if err != nil {
+				if err := s.fail(Event{Type: typePage, File: stateKey(s.pagesDir(), p.LocalFile), Action: "create"}, err); err != nil {
+					return createdPages, err
+				}
+				continue
+			}
+
+			rp.LocalFile = p.LocalFile // do I need to merge all data
+			rp.SyncDate = time.Now()
+			if err := s.saveRemotePage(rp); err != nil {
+				if err := s.fail(Event{Type: typePage, File: stateKey(s.pagesDir(), p.LocalFile), Id: rp.Id, URL: rp.URL, Action: "save"}, err); err != nil {
+					return createdPages, err
+				}
+				continue
+			}
+			log.Infof("New page: %s %s", p.LocalFile, rp.URL)
+			s.record(Event{Event: "created", Type: typePage, File: stateKey(s.pagesDir(), p.LocalFile), Id: rp.Id, URL: rp.URL})
+			createdPages = append(createdPages, rp)
+		}
+	}
+	return createdPages, nil
+}
+
+func (s *Syncer) loadPagesFromFiles(pages []Page) (loadedPages []Page) {
+	for _, p := range pages {
+		lp := s.loadPageFromFile(p)
+		loadedPages = append(loadedPages, lp)
+	}
+	return loadedPages
+}
+
+func (s *Syncer) loadPageFromFile(p Page) Page {
+	page := s.readParsePageFile(p.LocalFile)
+	mergo.Merge(&page, p)
+	return page
+}
+
+// updatePages loops through pages and updates
+// pages are returned with new Date set
+func (s *Syncer) updatePages(ctx context.Context, pages []Page) (updatedPages []Page, err error) {
+	for _, p := range pages {
+		if s.confirm(fmt.Sprintf("Update page %s, Continue (y/N)? ", p.LocalFile)) {
+			p.SyncId = s.ensureSyncId(s.path(stateKey(s.pagesDir(), p.LocalFile)), p.SyncId)
+			p.Path = stateKey(s.pagesDir(), p.LocalFile)
+			rp, err := s.Client.UpdatePage(ctx, p)
+			if errors.Is(err, ErrDeleted) {
+				// deleted on the site, create it again
+				log.Warnf("Page not found on site, creating again: %v", p.LocalFile)
+				p.Id = 0
+				rp, err = s.Client.CreatePage(ctx, p)
+			}
+			if err != nil {
+				if err := s.fail(Event{Type: typePage, File: stateKey(s.pagesDir(), p.LocalFile), Action: "update"}, err); err != nil {
+					return updatedPages, err
+				}
+				continue
+			}
+
+			rp.SyncDate = time.Now()
+			if err := s.saveRemotePage(rp); err != nil {
+				if err := s.fail(Event{Type: typePage, File: stateKey(s.pagesDir(), p.LocalFile), Id: rp.Id, URL: rp.URL, Action: "save"}, err); err != nil {
+					return updatedPages, err
+				}
+				continue
+			}
+			log.Infof("Updated page: %s %s", p.LocalFile, rp.URL)
+			s.record(Event{Event: "updated", Type: typePage, File: stateKey(s.pagesDir(), p.LocalFile), Id: rp.Id, URL: rp.URL})
+			log.Debugf("Updated SyncDate to: %v", rp.SyncDate.Unix())
+			updatedPages = append(updatedPages, rp)
+		}
+	}
+	return updatedPages, nil
+}
+
+// saveRemotePage records a created or updated page in
+// state, called after each page so progress is kept
+func (s *Syncer) saveRemotePage(page Page) error {
+	key := stateKey(s.pagesDir(), page.LocalFile)
+	err := s.saveStateItem(key, StateItem{
+		Type:     typePage,
+		Id:       page.Id,
+		URL:      page.URL,
+		Status:   page.Status,
+		SyncId:   page.SyncId,
+		ModDate:  fileModDate(s.path(key)),
+		SyncDate: page.SyncDate,
+		Hash:     fileHash(s.path(key)),
+	})
+	if err != nil {
+		return err
+	}
+
+	// drop the old path after a rename, saved first so a
+	// crash in between never loses the item
+	if page.PrevFile != "" {
+		return s.removeStateItem(stateKey(s.pagesDir(), page.PrevFile))
+	}
+	return nil
+}
+
+// readParseFile reads a markdown file and returns a Page struct
+func (s *Syncer) readParsePageFile(filename string) (page Page) {
+
+	// setup default data
+	page = Page{
+		Title:    "",
+		Content:  "",
+		Template: "",
+		ParentId: 0,
+		Status:   "publish",
+	}
+
+	var data, err = ioutil.ReadFile(s.path(stateKey(s.pagesDir(), filename)))
+	if err != nil {
+		log.Warnf(">>Error: can't read file: %v", filename)
+	}
+
+	// parse front matter from --- to ---
+	var lines = strings.Split(string(data), "\n")
+	var found = 0
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if found == 1 {
+			// parse line for param
+			colonIndex := strings.Index(line, ":")
+			if colonIndex > 0 {
+				key := strings.TrimSpace(line[:colonIndex])
+				value := strings.TrimSpace(line[colonIndex+1:])
+				value = strings.Trim(value, "\"") //remove quotes
+				switch key {
+				case "title":
+					page.Title = value
+				case metaIdKey:
+					page.SyncId = value
+				case "template":
+					page.Template = value
+				case "parent":
+					page.ParentId, _ = strconv.Atoi(value)
+				case "status":
+					page.Status = value
+				case "order":
+					page.Order = value
+				}
+			}
+		} else if found >= 2 {
+			// params over
+			lines = lines[i:]
+			break
+		}
+
+		if line == "---" {
+			found += 1
+		}
+	}
+
+	// slurp rest of content
+	content := s.resolveMediaURLs(strings.Join(lines, "\n"))
+	page.Content = string(blackfriday.Run([]byte(content)))
+
+	return page
+}
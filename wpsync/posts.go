@@ -0,0 +1,296 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/imdario/mergo"
+	"gopkg.in/russross/blackfriday.v2"
+)
+
+// getLocalPosts reads posts from local directory
+func (s *Syncer) getLocalPosts() (posts []Post) {
+	files, err := ioutil.ReadDir(s.path(s.postsDir()))
+	if err != nil {
+		log.Infof("Error reading posts directory: %v", err)
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			// a directory with index.md is a post bundle
+			if bundle, ok := s.getLocalBundle(file.Name()); ok {
+				posts = append(posts, bundle)
+			}
+		} else if strings.Contains(file.Name(), ".md") {
+			post := Post{}
+			post.LocalFile = file.Name()
+			post.SyncId = readSyncId(s.path(stateKey(s.postsDir(), file.Name())))
+			post.ModDate = file.ModTime()
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+// getRemotePosts reads synced posts from state
+func (s *Syncer) getRemotePosts() (posts []Post, err error) {
+	files, items, err := s.stateItems(typePost, s.postsDir())
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		posts = append(posts, Post{
+			Id:        item.Id,
+			URL:       item.URL,
+			Status:    item.Status,
+			SyncId:    item.SyncId,
+			LocalFile: files[i],
+			SyncDate:  item.SyncDate,
+		})
+	}
+	return posts, nil
+}
+
+// comparePosts returns local posts that do not exist in remote
+func (s *Syncer) comparePosts(local, remote []Post) (newPosts, updatePosts []Post) {
+	for _, lp := range local {
+		exists := false
+		for _, rp := range remote {
+			renamed := lp.LocalFile != rp.LocalFile && lp.SyncId != "" && lp.SyncId == rp.SyncId
+			if renamed && fileExists(s.path(stateKey(s.postsDir(), rp.LocalFile))) {
+				// both files exist, so a copy not a rename
+				log.Warnf("Skipping %v same %v as %v remove it from the copy", lp.LocalFile, metaIdKey, rp.LocalFile)
+				s.record(Event{Event: "skipped", Type: typePost, File: stateKey(s.postsDir(), lp.LocalFile)})
+				exists = true
+				continue
+			}
+			if lp.LocalFile == rp.LocalFile || renamed {
+				exists = true
+				lp.Id = rp.Id // set Id from remote
+				if renamed {
+					log.Infof("Renamed post: %s to %s", rp.LocalFile, lp.LocalFile)
+					lp.PrevFile = rp.LocalFile
+					updatePosts = append(updatePosts, lp)
+				} else if lp.ModDate.After(rp.SyncDate) {
+					log.Debugf("Local File: %v", lp.LocalFile)
+					log.Debugf("Local ModDate  : %v", lp.ModDate.Unix())
+					log.Debugf("Remote SyncDate: %v", rp.SyncDate.Unix())
+					updatePosts = append(updatePosts, lp)
+				} else {
+					log.Debugf("Skipping %v", lp.LocalFile)
+					s.record(Event{Event: "skipped", Type: typePost, File: stateKey(s.postsDir(), lp.LocalFile), Id: rp.Id, URL: rp.URL})
+				}
+			}
+		}
+		if !exists {
+			newPosts = append(newPosts, lp)
+		}
+	}
+	return newPosts, updatePosts
+}
+
+// createPosts loops through posts and uploads
+// posts are returned with Id/Url set
+func (s *Syncer) createPosts(ctx context.Context, newPosts []Post) (createdPosts []Post, err error) {
+	for _, p := range newPosts {
+		if s.confirm(fmt.Sprintf("New post %s, Continue (y/N)? ", p.LocalFile)) {
+			p.SyncId = s.ensureSyncId(s.path(stateKey(s.postsDir(), p.LocalFile)), p.SyncId)
+			p.Path = stateKey(s.postsDir(), p.LocalFile)
+			rp, err := s.Client.CreatePost(ctx, p)
+			if err != nil {
+				if err := s.fail(Event{Type: typePost, File: stateKey(s.postsDir(), p.LocalFile), Action: "create"}, err); err != nil {
+					return createdPosts, err
+				}
+				continue
+			}
+			rp.LocalFile = p.LocalFile // do I need to merge all data
+
+			if isBundle(p.LocalFile) {
+				// bundle media attaches to the post, so is
+				// uploaded once the post exists and then linked
+				bp, err := s.syncBundle(ctx, rp)
+				if err == nil {
+					bp, err = s.Client.UpdatePost(ctx, bp)
+				}
+				if err != nil {
+					// keep the created post, it is updated next sync
+					if err := s.saveRemotePost(rp); err != nil {
+						log.Warnf("%v", err)
+					}
+					if err := s.fail(Event{Type: typePost, File: stateKey(s.postsDir(), p.LocalFile), Action: "update bundle"}, err); err != nil {
+						return createdPosts, err
+					}
+					continue
+				}
+				rp = bp
+				rp.LocalFile = p.LocalFile
+			}
+
+			rp.SyncDate = time.Now()
+			if err := s.saveRemotePost(rp); err != nil {
+				if err := s.fail(Event{Type: typePost, File: stateKey(s.postsDir(), p.LocalFile), Id: rp.Id, URL: rp.URL, Action: "save"}, err); err != nil {
+					return createdPosts, err
+				}
+				continue
+			}
+			log.Infof("New post: %s %s", p.LocalFile, rp.URL)
+			s.record(Event{Event: "created", Type: typePost, File: stateKey(s.postsDir(), p.LocalFile), Id: rp.Id, URL: rp.URL})
+			createdPosts = append(createdPosts, rp)
+		}
+	}
+	return createdPosts, nil
+}
+
+func (s *Syncer) loadPostsFromFiles(posts []Post) (loadedPosts []Post) {
+	for _, p := range posts {
+		lp := s.loadPostFromFile(p)
+		loadedPosts = append(loadedPosts, lp)
+	}
+	return loadedPosts
+}
+
+func (s *Syncer) loadPostFromFile(p Post) Post {
+	post := s.readParseFile(p.LocalFile)
+	mergo.Merge(&post, p)
+	return post
+}
+
+// updatePosts loops through posts and updates
+// posts are returned with new Date set
+func (s *Syncer) updatePosts(ctx context.Context, posts []Post) (updatedPosts []Post, err error) {
+	for _, p := range posts {
+		if s.confirm(fmt.Sprintf("Update post %s, Continue (y/N)? ", p.LocalFile)) {
+			p.SyncId = s.ensureSyncId(s.path(stateKey(s.postsDir(), p.LocalFile)), p.SyncId)
+			p.Path = stateKey(s.postsDir(), p.LocalFile)
+			if isBundle(p.LocalFile) {
+				if p, err = s.syncBundle(ctx, p); err != nil {
+					return updatedPosts, err
+				}
+			}
+			rp, err := s.Client.UpdatePost(ctx, p)
+			if errors.Is(err, ErrDeleted) {
+				// deleted on the site, create it again
+				log.Warnf("Post not found on site, creating again: %v", p.LocalFile)
+				p.Id = 0
+				rp, err = s.Client.CreatePost(ctx, p)
+			}
+			if err != nil {
+				if err := s.fail(Event{Type: typePost, File: stateKey(s.postsDir(), p.LocalFile), Action: "update"}, err); err != nil {
+					return updatedPosts, err
+				}
+				continue
+			}
+
+			rp.SyncDate = time.Now()
+			if err := s.saveRemotePost(rp); err != nil {
+				if err := s.fail(Event{Type: typePost, File: stateKey(s.postsDir(), p.LocalFile), Id: rp.Id, URL: rp.URL, Action: "save"}, err); err != nil {
+					return updatedPosts, err
+				}
+				continue
+			}
+			log.Infof("Updated post: %s %s", p.LocalFile, rp.URL)
+			s.record(Event{Event: "updated", Type: typePost, File: stateKey(s.postsDir(), p.LocalFile), Id: rp.Id, URL: rp.URL})
+			log.Debugf("Updated SyncDate to: %v", rp.SyncDate.Unix())
+			updatedPosts = append(updatedPosts, rp)
+		}
+	}
+	return updatedPosts, nil
+}
+
+// saveRemotePost records a created or updated post in
+// state, called after each post so progress is kept
+func (s *Syncer) saveRemotePost(post Post) error {
+	key := stateKey(s.postsDir(), post.LocalFile)
+	err := s.saveStateItem(key, StateItem{
+		Type:     typePost,
+		Id:       post.Id,
+		URL:      post.URL,
+		Status:   post.Status,
+		SyncId:   post.SyncId,
+		ModDate:  fileModDate(s.path(key)),
+		SyncDate: post.SyncDate,
+		Hash:     fileHash(s.path(key)),
+	})
+	if err != nil {
+		return err
+	}
+
+	// drop the old path after a rename, saved first so a
+	// crash in between never loses the item
+	if post.PrevFile != "" {
+		return s.removeStateItem(stateKey(s.postsDir(), post.PrevFile))
+	}
+	return nil
+}
+
+// readParseFile reads a markdown file and returns a Post struct
+func (s *Syncer) readParseFile(filename string) (post Post) {
+
+	// setup default data
+	post = Post{
+		Title:    "",
+		Content:  "",
+		Category: "",
+		Date:     time.Now().Format(time.RFC3339),
+		Tags:     "",
+		Status:   "publish",
+	}
+
+	var data, err = ioutil.ReadFile(s.path(stateKey(s.postsDir(), filename)))
+	if err != nil {
+		log.Warnf(">>Error: can't read file: %v", filename)
+	}
+
+	// parse front matter from --- to ---
+	var lines = strings.Split(string(data), "\n")
+	var found = 0
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if found == 1 {
+			// parse line for param
+			colonIndex := strings.Index(line, ":")
+			if colonIndex > 0 {
+				key := strings.TrimSpace(line[:colonIndex])
+				value := strings.TrimSpace(line[colonIndex+1:])
+				value = strings.Trim(value, "\"") //remove quotes
+				switch key {
+				case "title":
+					post.Title = value
+				case metaIdKey:
+					post.SyncId = value
+				case "date":
+					d, err := time.Parse("2006-01-02", value)
+					if err == nil {
+						post.Date = d.Format(time.RFC3339)
+					}
+				case "category":
+					post.Category = value
+				case "tags":
+					post.Tags = value
+				case "gallery":
+					post.Gallery = value
+				case "status":
+					post.Status = value
+				}
+			}
+		} else if found >= 2 {
+			// params over
+			lines = lines[i:]
+			break
+		}
+
+		if line == "---" {
+			found += 1
+		}
+	}
+
+	// slurp rest of content
+	content := s.resolveMediaURLs(strings.Join(lines, "\n"))
+	post.Content = string(blackfriday.Run([]byte(content)))
+
+	return post
+}
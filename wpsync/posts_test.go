@@ -1,10 +1,12 @@
-package main
+package wpsync
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
 )
@@ -30,8 +32,9 @@ func TestPublishStatus(t *testing.T) {
 
 	ts := httptest.NewServer(http.HandlerFunc(statusHandler))
 	defer ts.Close()
+	defer chdirTemp(t)()
 
-	conf.SiteURL = ts.URL
+	s := &Syncer{Client: NewClient(ts.URL, "")}
 
 	var newPosts = []Post{
 		Post{
@@ -44,7 +47,7 @@ func TestPublishStatus(t *testing.T) {
 		},
 	}
 
-	createdPosts := createPosts(newPosts)
+	createdPosts, _ := s.createPosts(context.Background(), newPosts)
 	// check createPosts status
 	if len(createdPosts) == 0 {
 		t.Error("No created posts")
@@ -73,8 +76,9 @@ func TestUpdatePost(t *testing.T) {
 	// server does not matter
 	ts := httptest.NewServer(http.HandlerFunc(emptyHandler))
 	defer ts.Close()
+	defer chdirTemp(t)()
 
-	conf.SiteURL = ts.URL
+	s := &Syncer{Client: NewClient(ts.URL, "")}
 
 	// create a post in updated array that was
 	// previously sync an hourago
@@ -86,7 +90,7 @@ func TestUpdatePost(t *testing.T) {
 	}
 
 	// Do the thing
-	updatedPosts = updatePosts(updatedPosts)
+	updatedPosts, _ = s.updatePosts(context.Background(), updatedPosts)
 
 	// confirm post sync date is updated
 	if len(updatedPosts) == 0 {
@@ -97,3 +101,27 @@ func TestUpdatePost(t *testing.T) {
 		}
 	}
 }
+
+// chdirTemp changes to a temp directory so state files written
+// during a test do not land in the source tree, returns restore
+func chdirTemp(t *testing.T) func() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Chdir(cwd)
+	}
+}
+
+// stateOf reads the state of s, failing the test on error
+func stateOf(t *testing.T, s *Syncer) State {
+	state, err := s.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
@@ -0,0 +1,82 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Promote pushes to this site the local files that are synced
+// and unchanged on the from site, so only content reviewed
+// there is published. Files new or changed since they were
+// synced to the from site are left out.
+func (s *Syncer) Promote(ctx context.Context, from string) (Summary, error) {
+	if from == s.Config.Site {
+		return Summary{}, errors.New("Can not promote a site to itself")
+	}
+	filename := s.path(statePath(from))
+	if !fileExists(filename) {
+		return Summary{}, fmt.Errorf("%v not found, sync to %v first", filename, from)
+	}
+
+	state, err := readState(filename)
+	if err != nil {
+		return Summary{}, err
+	}
+	s.filter = func(key string) bool {
+		if s.promotable(state, key) {
+			return true
+		}
+		log.Infof("Not promoting %v, not synced to %v or changed since", key, from)
+		return false
+	}
+	defer func() { s.filter = nil }()
+
+	return s.Push(ctx)
+}
+
+// promotable returns true if the file is in state with the same
+// content, for a bundle also all of its media
+func (s *Syncer) promotable(state State, key string) bool {
+	item, ok := state.Items[key]
+	if !ok || item.Hash == "" || item.Hash != fileHash(s.path(key)) {
+		return false
+	}
+	if item.Type == typePost && isBundle(strings.TrimPrefix(key, s.postsDir()+"/")) {
+		for _, m := range s.getBundleMedia(path.Dir(key)) {
+			mkey := s.mediaKey(m)
+			if mi, ok := state.Items[mkey]; !ok || mi.Hash != m.Hash {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// filterPosts returns the posts included in the run
+func (s *Syncer) filterPosts(posts []Post) (included []Post) {
+	if s.filter == nil {
+		return posts
+	}
+	for _, p := range posts {
+		if s.filter(stateKey(s.postsDir(), p.LocalFile)) {
+			included = append(included, p)
+		}
+	}
+	return included
+}
+
+// filterPages returns the pages included in the run
+func (s *Syncer) filterPages(pages []Page) (included []Page) {
+	if s.filter == nil {
+		return pages
+	}
+	for _, p := range pages {
+		if s.filter(stateKey(s.pagesDir(), p.LocalFile)) {
+			included = append(included, p)
+		}
+	}
+	return included
+}
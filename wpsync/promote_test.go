@@ -0,0 +1,60 @@
+package wpsync
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// TestPromote pushes only files unchanged since synced to
+// the from site, and keeps state for each site
+func TestPromote(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("posts", 0755)
+	files := map[string]string{
+		"posts/reviewed.md": "---\ntitle: Reviewed\nwpsync_id: a1\n---\nHi",
+		"posts/changed.md":  "---\ntitle: Changed\nwpsync_id: b2\n---\nHi",
+		"posts/new.md":      "---\ntitle: New\nwpsync_id: c3\n---\nHi",
+	}
+	for f, data := range files {
+		if err := ioutil.WriteFile(f, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	staging := &Syncer{Config: Config{Site: "staging"}}
+	staging.saveStateItem("posts/reviewed.md", StateItem{Type: typePost, Id: 1, Hash: fileHash("posts/reviewed.md")})
+	staging.saveStateItem("posts/changed.md", StateItem{Type: typePost, Id: 2, Hash: "old"})
+
+	var created []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		created = append(created, r.FormValue("title"))
+		fmt.Fprint(w, `{"id": 10, "link": "http://prod/reviewed"}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Config: Config{Site: "production"}, Client: NewClient(ts.URL, "")}
+	if _, err := s.Promote(context.Background(), "production"); err == nil {
+		t.Error("Expected error promoting to the same site")
+	}
+	summary, err := s.Promote(context.Background(), "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created) != 1 || created[0] != "Reviewed" || summary.Created != 1 {
+		t.Fatal("Expected only the reviewed post created", created)
+	}
+	if stateOf(t, s).Items["posts/reviewed.md"].Id != 10 {
+		t.Error("Production state not written")
+	}
+	if stateOf(t, staging).Items["posts/reviewed.md"].Id != 1 {
+		t.Error("Staging state changed")
+	}
+}
@@ -0,0 +1,225 @@
+package wpsync
+
+import (
+	"context"
+	"html"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Reconcile rebuilds state by matching local files to items
+// that already exist on the site, nothing is created remotely.
+// Files already in state are left as they are.
+func (s *Syncer) Reconcile(ctx context.Context) error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	defer s.ReleaseLock()
+
+	state, err := s.loadState()
+	if err != nil {
+		return err
+	}
+	matched, unmatched := 0, 0
+
+	// each remote item is matched to one file at most
+	used := map[int]bool{}
+	for _, item := range state.Items {
+		used[item.Id] = true
+	}
+
+	remotePosts, err := s.Client.ListPosts(ctx, url.Values{"status": {"any"}})
+	if err != nil {
+		return err
+	}
+	localPosts := s.getLocalPosts()
+	var local []localItem
+	for _, p := range localPosts {
+		key := stateKey(s.postsDir(), p.LocalFile)
+		if _, ok := state.Items[key]; ok {
+			continue
+		}
+		title := s.readParseFile(p.LocalFile).Title
+		local = append(local, localItem{key, p.SyncId, p.LocalFile, title})
+	}
+	found := matchRemoteItems(local, remotePosts, used)
+	for _, l := range local {
+		if r, ok := found[l.key]; ok {
+			state.Items[l.key] = s.reconciledItem(typePost, l.key, r)
+			log.Infof("Matched post: %v %v", l.key, r.Link)
+			matched++
+		} else {
+			log.Infof("No match for post: %v", l.key)
+			unmatched++
+		}
+	}
+
+	remotePages, err := s.Client.ListPages(ctx, url.Values{"status": {"any"}})
+	if err != nil {
+		return err
+	}
+	local = nil
+	for _, p := range s.getLocalPages() {
+		key := stateKey(s.pagesDir(), p.LocalFile)
+		if _, ok := state.Items[key]; ok {
+			continue
+		}
+		title := s.readParsePageFile(p.LocalFile).Title
+		local = append(local, localItem{key, p.SyncId, p.LocalFile, title})
+	}
+	found = matchRemoteItems(local, remotePages, used)
+	for _, l := range local {
+		if r, ok := found[l.key]; ok {
+			state.Items[l.key] = s.reconciledItem(typePage, l.key, r)
+			log.Infof("Matched page: %v %v", l.key, r.Link)
+			matched++
+		} else {
+			log.Infof("No match for page: %v", l.key)
+			unmatched++
+		}
+	}
+
+	remoteMedia, err := s.Client.ListMedia(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// bundle media is matched the same as media
+	localMedia := s.getLocalMedia()
+	for _, p := range localPosts {
+		if isBundle(p.LocalFile) {
+			localMedia = append(localMedia, s.getBundleMedia(stateKey(s.postsDir(), path.Dir(p.LocalFile)))...)
+		}
+	}
+	for _, m := range localMedia {
+		key := s.mediaKey(m)
+		if _, ok := state.Items[key]; ok {
+			continue
+		}
+		if r, ok := matchRemoteMedia(remoteMedia, used, m.LocalFile); ok {
+			used[r.Id] = true
+			item := s.reconciledItem(typeMedia, key, r)
+			item.URL = r.SourceURL
+			item.Link = r.Link
+			state.Items[key] = item
+			log.Infof("Matched media: %v %v", key, r.SourceURL)
+			matched++
+		} else {
+			log.Infof("No match for media: %v", key)
+			unmatched++
+		}
+	}
+
+	log.Infof("Matched %v items, %v unmatched will be created on next sync", matched, unmatched)
+	if s.Dryrun {
+		log.Infof("Dry run, state not written")
+		return nil
+	}
+	return s.writeState(state)
+}
+
+// localItem is a local post or page not yet in state
+type localItem struct {
+	key, syncId, filename, title string
+}
+
+// matchRemoteItems finds the remote post or page for each local
+// file, trying the wpsync meta keys, then slug, then title. All
+// files are tried with one way before the next, so a weaker
+// match never takes the item another file names, and each item
+// not in used is matched once. Returns matches by state key.
+func matchRemoteItems(local []localItem, items []RemoteItem, used map[int]bool) map[string]RemoteItem {
+	matchers := []func(l localItem, r RemoteItem) bool{
+		func(l localItem, r RemoteItem) bool {
+			return l.syncId != "" && r.MetaValue(metaIdKey) == l.syncId
+		},
+		func(l localItem, r RemoteItem) bool {
+			return r.MetaValue(metaPathKey) == l.key
+		},
+		func(l localItem, r RemoteItem) bool {
+			// a bundle is named by its directory
+			filename := l.filename
+			if isBundle(filename) {
+				filename = path.Dir(filename)
+			}
+			return r.Slug == slugify(strings.TrimSuffix(filename, path.Ext(filename)))
+		},
+		func(l localItem, r RemoteItem) bool {
+			return l.title != "" && (r.Title.Raw == l.title || html.UnescapeString(r.Title.Rendered) == l.title)
+		},
+	}
+
+	found := map[string]RemoteItem{}
+	for _, match := range matchers {
+		for _, l := range local {
+			if _, ok := found[l.key]; ok {
+				continue
+			}
+			for _, r := range items {
+				if !used[r.Id] && match(l, r) {
+					used[r.Id] = true
+					found[l.key] = r
+					break
+				}
+			}
+		}
+	}
+	return found
+}
+
+// matchRemoteMedia finds the attachment for a local file by
+// the filename in its source url, or its slug, skipping items
+// in used which are already matched to another file
+func matchRemoteMedia(items []RemoteItem, used map[int]bool, filename string) (RemoteItem, bool) {
+	for _, r := range items {
+		if !used[r.Id] && path.Base(r.SourceURL) == filename {
+			return r, true
+		}
+	}
+
+	slug := slugify(strings.TrimSuffix(filename, path.Ext(filename)))
+	for _, r := range items {
+		if !used[r.Id] && r.Slug == slug {
+			return r, true
+		}
+	}
+	return RemoteItem{}, false
+}
+
+// reconciledItem builds the state for a matched item, the
+// sync date is the remote modified date so local edits made
+// since then are pushed on the next sync
+func (s *Syncer) reconciledItem(itemType, key string, r RemoteItem) StateItem {
+	syncDate := r.ModifiedTime()
+	if syncDate.IsZero() {
+		syncDate = time.Now()
+	}
+	return StateItem{
+		Type:     itemType,
+		Id:       r.Id,
+		URL:      r.Link,
+		Status:   r.Status,
+		SyncId:   r.MetaValue(metaIdKey),
+		ModDate:  fileModDate(s.path(key)),
+		SyncDate: syncDate,
+		Hash:     fileHash(s.path(key)),
+	}
+}
+
+// slugify lowercases and replaces anything not a letter or
+// number with a dash, similar to WordPress sanitize_title
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,86 @@
+package wpsync
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReconcile matches local files to remote items by meta,
+// slug and media filename without creating anything, and
+// matches each remote item to one file
+func TestReconcile(t *testing.T) {
+	defer chdirTemp(t)()
+
+	files := map[string]string{
+		"posts/hello.md":      "---\ntitle: Hello\n---\nHi",
+		"posts/hello-copy.md": "---\ntitle: Hello\n---\nHi",
+		"posts/renamed.md":    "---\ntitle: Renamed\n---\nHi",
+		"posts/new.md":        "---\ntitle: New\n---\nHi",
+		"media/a.jpg":         "jpg",
+
+		"posts/trip/index.md":  "---\ntitle: Trip\n---\n![Beach](beach.jpg)",
+		"posts/trip/beach.jpg": "jpg",
+	}
+	for f, data := range files {
+		os.MkdirAll(filepath.Dir(f), 0755)
+		if err := ioutil.WriteFile(f, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Error("Reconcile should not create, got", r.Method)
+		}
+		switch r.URL.Path {
+		case "/wp-json/wp/v2/posts":
+			fmt.Fprint(w, `[
+				{"id": 5, "slug": "hello", "link": "http://x/hello", "status": "publish", "meta": []},
+				{"id": 6, "slug": "other", "link": "http://x/other", "meta": {"wpsync_path": "posts/renamed.md"}},
+				{"id": 7, "slug": "trip", "link": "http://x/trip"}
+			]`)
+		case "/wp-json/wp/v2/media":
+			fmt.Fprint(w, `[
+				{"id": 9, "slug": "a", "source_url": "http://x/uploads/a.jpg"},
+				{"id": 11, "slug": "beach", "source_url": "http://x/uploads/beach.jpg"}
+			]`)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+
+	if err := s.Reconcile(context.Background()); err != nil {
+		t.Fatal("Reconcile failed", err)
+	}
+
+	state := stateOf(t, s)
+	if state.Items["posts/hello.md"].Id != 5 {
+		t.Error("Post not matched by slug", state.Items)
+	}
+	if state.Items["posts/renamed.md"].Id != 6 {
+		t.Error("Post not matched by meta", state.Items)
+	}
+	if _, ok := state.Items["posts/new.md"]; ok {
+		t.Error("Unmatched post should not be in state")
+	}
+	if _, ok := state.Items["posts/hello-copy.md"]; ok {
+		t.Error("Copy with the same title should not match the same post", state.Items)
+	}
+	if state.Items["media/a.jpg"].Id != 9 {
+		t.Error("Media not matched by filename", state.Items)
+	}
+	if state.Items["posts/trip/index.md"].Id != 7 || state.Items["posts/trip/beach.jpg"].Id != 11 {
+		t.Error("Bundle or bundle media not matched", state.Items)
+	}
+}
@@ -0,0 +1,99 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaults used when not set in wpsync.json
+const (
+	defaultRetries      = 3
+	defaultRetryWait    = 1  // seconds
+	defaultRetryMaxWait = 30 // seconds
+)
+
+// sleep waits for d or until ctx is cancelled, it is a
+// variable so tests can skip the waiting
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isRetryable returns true for connection errors and status
+// codes that signal a temporary problem. A create is only
+// retried when the server did not handle it, otherwise a retry
+// could create a duplicate, an update is safe to send again.
+func isRetryable(create bool, resp Response, err error) bool {
+	if create {
+		if err != nil {
+			return isDialError(err)
+		}
+		return resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode == http.StatusServiceUnavailable
+	}
+
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isDialError returns true if the connection could not be
+// made, so the request never reached the server
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// backoff returns the wait before the next attempt, doubling
+// each attempt up to the max, with jitter to spread retries
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.RetryWait << uint(attempt)
+	if wait > c.RetryMaxWait || wait <= 0 {
+		wait = c.RetryMaxWait
+	}
+
+	// jitter between half and full wait
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryAfter parses the Retry-After header, which is either
+// a number of seconds or an HTTP date, zero if not set
+func retryAfter(resp Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
@@ -0,0 +1,210 @@
+package wpsync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRetryTransient retries a 503 and succeeds on next attempt
+func TestRetryTransient(t *testing.T) {
+	var waits []time.Duration
+	saved := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	defer func() { sleep = saved }()
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"id": 42}`)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "")
+
+	post, err := c.CreatePost(context.Background(), Post{LocalFile: "retry.md"})
+	if err != nil {
+		t.Fatal("Expected success after retry", err)
+	}
+	if post.Id != 42 {
+		t.Error("Post id not set from response")
+	}
+	if calls != 2 {
+		t.Error("Expected 2 calls, got", calls)
+	}
+	if len(waits) != 1 || waits[0] < 5*time.Second {
+		t.Error("Retry-After not honoured", waits)
+	}
+}
+
+// TestRetryGivesUp stops after configured retries
+func TestRetryGivesUp(t *testing.T) {
+	saved := sleep
+	sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	defer func() { sleep = saved }()
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "")
+	c.Retries = 2
+
+	_, err := c.CreatePost(context.Background(), Post{LocalFile: "fail.md"})
+	if err == nil {
+		t.Error("Expected error after retries exhausted")
+	}
+	if calls != 3 {
+		t.Error("Expected 3 calls, got", calls)
+	}
+}
+
+// TestBackoff doubles and caps the wait
+func TestBackoff(t *testing.T) {
+	c := NewClient("", "")
+	c.RetryWait = time.Second
+	c.RetryMaxWait = 4 * time.Second
+
+	for attempt, max := range []time.Duration{1, 2, 4, 4, 4} {
+		wait := c.backoff(attempt)
+		if wait < max*time.Second/2 || wait > max*time.Second {
+			t.Errorf("Attempt %d wait %v outside range", attempt, wait)
+		}
+	}
+}
+
+// TestNoRetryCreateTimeout does not send a create again once
+// the server may have handled it, it would make a duplicate
+func TestNoRetryCreateTimeout(t *testing.T) {
+	saved := sleep
+	sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	defer func() { sleep = saved }()
+
+	var calls int32
+	release := make(chan bool)
+	finished := make(chan bool, 1)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Method == "POST" {
+			// answer only once the client has timed out
+			defer func() { finished <- true }()
+			<-release
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "")
+	c.HTTPClient.Timeout = 50 * time.Millisecond
+	if _, err := c.CreatePost(context.Background(), Post{LocalFile: "slow.md"}); err == nil {
+		t.Error("Expected timeout error")
+	}
+	close(release)
+	<-finished
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("Expected create sent once, got", n)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	c.ListPosts(context.Background(), nil)
+	if n := atomic.LoadInt32(&calls); n != 4 {
+		t.Error("Expected list retried, got", n)
+	}
+}
+
+// TestRetryUpdate retries an update, which is safe to send
+// again, but not a create the server may have handled
+func TestRetryUpdate(t *testing.T) {
+	saved := sleep
+	sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	defer func() { sleep = saved }()
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "")
+	c.Retries = 2
+	if _, err := c.UpdatePost(context.Background(), Post{Id: 5}); err == nil {
+		t.Error("Expected error after retries exhausted")
+	}
+	if calls != 3 {
+		t.Error("Expected update retried, got", calls)
+	}
+
+	calls = 0
+	if _, err := c.CreatePost(context.Background(), Post{}); err == nil {
+		t.Error("Expected error")
+	}
+	if calls != 1 {
+		t.Error("Expected create sent once, got", calls)
+	}
+}
+
+// TestRetryConfig allows turning retries off and caps Retry-After
+func TestRetryConfig(t *testing.T) {
+	var waits []time.Duration
+	saved := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	defer func() { sleep = saved }()
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	none := 0
+	c, _ := NewClientFromConfig(Config{SiteURL: ts.URL, Retries: &none})
+	c.ListPosts(context.Background(), nil)
+	if calls != 1 {
+		t.Error("Expected no retries with retries 0, got", calls)
+	}
+
+	c, _ = NewClientFromConfig(Config{SiteURL: ts.URL, RetryMaxWait: 2})
+	c.ListPosts(context.Background(), nil)
+	for _, w := range waits {
+		if w > 2*time.Second {
+			t.Error("Retry-After not capped", w)
+		}
+	}
+}
+
+// TestSleepCancel stops waiting when the context is cancelled
+func TestSleepCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sleep(ctx, time.Hour); err == nil {
+		t.Error("Expected sleep to return on cancel")
+	}
+}
@@ -0,0 +1,280 @@
+package wpsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const lockFilename = "wpsync.lock"
+
+// state directory and the schema version it is written with,
+// bump the version and add a migration when changing it
+const (
+	stateDir     = ".wpsync"
+	stateVersion = 1
+)
+
+// statePath returns the state file for a named site, each site
+// has its own ids so its own state, "" is the default site
+func statePath(site string) string {
+	if site == "" {
+		return stateDir + "/state.json"
+	}
+	return stateDir + "/state-" + site + ".json"
+}
+
+// State is the record of everything synced to the site,
+// items are keyed by local path such as posts/hello.md
+type State struct {
+	Version int                  `json:"version"`
+	Items   map[string]StateItem `json:"items"`
+}
+
+// StateItem is the synced state of a single local file
+type StateItem struct {
+	Type     string    `json:"type"`
+	Id       int       `json:"id"`
+	URL      string    `json:"url"`
+	Link     string    `json:"link,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	SyncId   string    `json:"sync_id,omitempty"`
+	ModDate  time.Time `json:"modified"`
+	SyncDate time.Time `json:"synced"`
+	Hash     string    `json:"hash,omitempty"`
+	MetaHash string    `json:"meta_hash,omitempty"`
+
+	// PrevURLs are earlier uploads of a changed media file,
+	// replaced by URL in content pushed to this site
+	PrevURLs []string `json:"prev_urls,omitempty"`
+
+	// Linked media uses an attachment found on the site, not
+	// uploaded for this file, so it is never deleted
+	Linked bool `json:"linked,omitempty"`
+}
+
+// item types stored in state
+const (
+	typePost  = "post"
+	typePage  = "page"
+	typeMedia = "media"
+)
+
+// writeFileAtomic writes data to a temp file in the same
+// directory and renames it over filename, so a crash part
+// way through never leaves a truncated state file
+func writeFileAtomic(filename string, data []byte) error {
+	dir := filepath.Dir(filename)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+"-*")
+	if err != nil {
+		return err
+	}
+	// clean up temp file on any failure
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// stateFile returns the state file of the site being synced
+func (s *Syncer) stateFile() string {
+	return s.path(statePath(s.Config.Site))
+}
+
+// lock creates the lock file, failing if another run already
+// holds it for this directory
+func (s *Syncer) lock() error {
+	filename := s.path(lockFilename)
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			pid := "unknown"
+			if data, err := ioutil.ReadFile(filename); err == nil {
+				pid = strings.TrimSpace(string(data))
+			}
+			msg := fmt.Sprintf("%s exists, another wpsync is running (pid %s). Remove the file if not.", filename, pid)
+			return errors.New(msg)
+		}
+		return err
+	}
+	defer f.Close()
+
+	s.locked = true
+	_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+	return err
+}
+
+// ReleaseLock removes the lock file if this Syncer holds it, a
+// run releases it when done so this is only needed to exit
+// part way through a run
+func (s *Syncer) ReleaseLock() {
+	if !s.locked {
+		return
+	}
+	filename := s.path(lockFilename)
+	if err := os.Remove(filename); err != nil {
+		log.Warnf("Error removing %v: %v", filename, err)
+	}
+	s.locked = false
+}
+
+// loadState reads the state file, returning empty state
+// if it does not exist yet
+func (s *Syncer) loadState() (State, error) {
+	return readState(s.stateFile())
+}
+
+// readState reads a state file, empty if it does not exist.
+// A file that can not be read or parsed is an error, syncing
+// without it would create everything on the site again.
+func readState(filename string) (state State, err error) {
+	state = State{Version: stateVersion, Items: map[string]StateItem{}}
+
+	// check if file exists, return empty
+	// likely scenario would be first run
+	file, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		log.Debugf("%v does not exist", filename)
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("Error reading %v: %v", filename, err)
+	}
+	if err := json.Unmarshal(file, &state); err != nil {
+		return state, fmt.Errorf("Error parsing %v: %v, fix or remove it and run wpsync reconcile", filename, err)
+	}
+	if state.Items == nil {
+		state.Items = map[string]StateItem{}
+	}
+	return state, nil
+}
+
+// checkState returns an error if the state file can not be
+// read, or is from a newer wpsync, writing it would lose what
+// it added
+func (s *Syncer) checkState() error {
+	state, err := s.loadState()
+	if err != nil {
+		return err
+	}
+	if state.Version > stateVersion {
+		return fmt.Errorf("%v is from a newer wpsync, please upgrade", s.stateFile())
+	}
+	return nil
+}
+
+// writeState writes the state file atomically
+func (s *Syncer) writeState(state State) error {
+	state.Version = stateVersion
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := s.stateFile()
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, data)
+}
+
+// saveStateItem sets the item for key and writes the state
+func (s *Syncer) saveStateItem(key string, item StateItem) error {
+	state, err := s.loadState()
+	if err != nil {
+		return err
+	}
+	state.Items[key] = item
+	if err := s.writeState(state); err != nil {
+		return fmt.Errorf("Error writing %v: %v", s.stateFile(), err)
+	}
+	log.Debugf("%v written", s.stateFile())
+	return nil
+}
+
+// removeStateItem deletes the item for key and writes the state
+func (s *Syncer) removeStateItem(key string) error {
+	state, err := s.loadState()
+	if err != nil {
+		return err
+	}
+	delete(state.Items, key)
+	if err := s.writeState(state); err != nil {
+		return fmt.Errorf("Error writing %v: %v", s.stateFile(), err)
+	}
+	return nil
+}
+
+// stateItems returns the items of a type sorted by key,
+// along with the key relative to dir to match LocalFile
+func (s *Syncer) stateItems(itemType, dir string) (files []string, items []StateItem, err error) {
+	state, err := s.loadState()
+	if err != nil {
+		return nil, nil, err
+	}
+	var keys []string
+	for key, item := range state.Items {
+		if item.Type == itemType {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		files = append(files, strings.TrimPrefix(key, dir+"/"))
+		items = append(items, state.Items[key])
+	}
+	return files, items, nil
+}
+
+// stateKey builds the state key for a file in a directory
+func stateKey(dir, filename string) string {
+	return path.Join(dir, filepath.ToSlash(filename))
+}
+
+// fileExists returns true if filename exists
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// fileHash returns the sha256 of a file, empty on error
+func fileHash(filename string) string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Debugf("Error hashing %v: %v", filename, err)
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileModDate returns the local file modification time,
+// zero if the file can not be read
+func fileModDate(filename string) (modDate time.Time) {
+	if fi, err := os.Stat(filename); err == nil {
+		modDate = fi.ModTime()
+	}
+	return modDate
+}
@@ -0,0 +1,150 @@
+package wpsync
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLock only allows one holder of the lock file
+func TestLock(t *testing.T) {
+	defer chdirTemp(t)()
+
+	first, second := &Syncer{}, &Syncer{}
+	if err := first.lock(); err != nil {
+		t.Fatal("Expected first lock to succeed", err)
+	}
+	if err := second.lock(); err == nil {
+		t.Error("Expected second lock to fail")
+	}
+
+	second.ReleaseLock() // not held, leaves the lock file
+	if !fileExists(lockFilename) {
+		t.Fatal("Lock released by a Syncer not holding it")
+	}
+	first.ReleaseLock()
+	if err := second.lock(); err != nil {
+		t.Error("Expected lock after release", err)
+	}
+	second.ReleaseLock()
+}
+
+// TestDir syncs content and keeps state in Config.Dir,
+// not the current directory
+func TestDir(t *testing.T) {
+	defer chdirTemp(t)()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "posts"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "posts", "hello.md"), []byte("---\ntitle: Hello\nwpsync_id: a1\n---\nHi"), 0644)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 3, "link": "http://x/hello"}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Config: Config{Dir: dir}, Client: NewClient(ts.URL, "")}
+	summary, err := s.Push(context.Background())
+	if err != nil || summary.Created != 1 {
+		t.Fatal("Expected post created", summary, err)
+	}
+	if item := stateOf(t, s).Items["posts/hello.md"]; item.Id != 3 || item.ModDate.IsZero() {
+		t.Error("State not written in Dir", item)
+	}
+	if fileExists(stateDir) || fileExists(filepath.Join(dir, lockFilename)) {
+		t.Error("Expected no state in current directory and lock released")
+	}
+}
+
+// TestBadState stops a run when the state file can not be
+// parsed, rather than syncing everything again
+func TestBadState(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("posts", 0755)
+	ioutil.WriteFile("posts/hello.md", []byte("Hi"), 0644)
+	os.MkdirAll(stateDir, 0755)
+	ioutil.WriteFile(statePath(""), []byte("{bad"), 0644)
+
+	s := &Syncer{Client: NewClient("http://127.0.0.1:0", "")}
+	if _, err := s.Push(context.Background()); err == nil {
+		t.Error("Expected error for unparsable state")
+	}
+	if data, _ := ioutil.ReadFile(statePath("")); string(data) != "{bad" {
+		t.Error("State file overwritten", string(data))
+	}
+	if fileExists(lockFilename) {
+		t.Error("Lock not released")
+	}
+}
+
+// TestSaveRemotePost keeps posts written after each save
+func TestSaveRemotePost(t *testing.T) {
+	defer chdirTemp(t)()
+
+	s := &Syncer{}
+	s.saveRemotePost(Post{Id: 1, LocalFile: "one.md", Status: "draft"})
+	s.saveRemotePost(Post{Id: 2, LocalFile: "two.md"})
+	s.saveRemotePost(Post{Id: 1, LocalFile: "one.md", Status: "publish"})
+
+	posts, _ := s.getRemotePosts()
+	if len(posts) != 2 {
+		t.Error("Expected 2 posts in state, got", len(posts))
+	} else if posts[0].Status != "publish" {
+		t.Error("Expected updated status, got", posts[0].Status)
+	}
+}
+
+// TestMigrateState converts legacy files keyed by local path
+// into the default site state
+func TestMigrateState(t *testing.T) {
+	defer chdirTemp(t)()
+
+	legacy := map[string]string{
+		"posts.json": `[{"id":1,"link":"http://x/one","status":"draft","LocalFile":"one.md"}]`,
+		"media.json": `[{"id":2,"source_url":"http://x/a.jpg","LocalFile":"a.jpg"}]`,
+	}
+	for f, data := range legacy {
+		if err := ioutil.WriteFile(f, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// legacy files are the default site state
+	staging := &Syncer{Config: Config{Site: "staging"}}
+	if !staging.NeedsMigration() {
+		t.Error("Expected migration needed for a named site")
+	}
+	if err := staging.MigrateState(); err == nil {
+		t.Error("Expected migrate refused for a named site")
+	}
+	if fileExists(staging.stateFile()) {
+		t.Error("Named site state written from legacy files")
+	}
+
+	s := &Syncer{}
+	if !s.NeedsMigration() {
+		t.Error("Expected migration needed")
+	}
+	if err := s.MigrateState(); err != nil {
+		t.Fatal("Migrate failed", err)
+	}
+	if s.NeedsMigration() || staging.NeedsMigration() {
+		t.Error("Expected no migration needed after migrate")
+	}
+
+	state := stateOf(t, s)
+	post := state.Items["posts/one.md"]
+	if post.Type != typePost || post.Id != 1 || post.Status != "draft" {
+		t.Error("Post not migrated", post)
+	}
+	if state.Items["media/a.jpg"].URL != "http://x/a.jpg" {
+		t.Error("Media not migrated", state.Items)
+	}
+}
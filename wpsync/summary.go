@@ -0,0 +1,85 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Event is one item of a run, e.g. a post created or a
+// file that failed to upload
+type Event struct {
+	Event  string    `json:"event"` // created, updated, linked, skipped, failed, would-create or would-update
+	Type   string    `json:"type"`  // post, page or media
+	File   string    `json:"file"`  // local path, e.g. posts/hello.md
+	Id     int       `json:"id,omitempty"`
+	URL    string    `json:"url,omitempty"`
+	Action string    `json:"action,omitempty"` // what failed, e.g. create
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Summary counts what a run did, or with Dryrun would do
+type Summary struct {
+	Created  int       `json:"created"`
+	Updated  int       `json:"updated"`
+	Linked   int       `json:"linked"`
+	Skipped  int       `json:"skipped"`
+	Failed   int       `json:"failed"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Failures []Event   `json:"-"`
+	Events   []Event   `json:"-"`
+}
+
+// record counts an event and passes it to OnEvent
+func (s *Syncer) record(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	sum := &s.Summary
+	switch ev.Event {
+	case "created", "would-create":
+		sum.Created++
+	case "updated", "would-update":
+		sum.Updated++
+	case "linked":
+		sum.Linked++
+	case "skipped":
+		sum.Skipped++
+	case "failed":
+		sum.Failed++
+		sum.Failures = append(sum.Failures, ev)
+	}
+	sum.Events = append(sum.Events, ev)
+
+	if s.OnEvent != nil {
+		s.OnEvent(ev)
+	}
+}
+
+// planned records an item a dry run would change, event is
+// would-create or would-update
+func (s *Syncer) planned(event, itemType, file string) {
+	log.Infof("Would %s %s %s", strings.TrimPrefix(event, "would-"), itemType, file)
+	s.record(Event{Event: event, Type: itemType, File: file})
+}
+
+// fail records a failed item, and returns ErrStopped with
+// FailFast, when the token is rejected since every following
+// request would fail the same way, or when ctx is cancelled.
+// The error wraps err too, so the cause can be checked.
+func (s *Syncer) fail(ev Event, err error) error {
+	log.Errorf("Failed to %s %s %s: %v", ev.Action, ev.Type, ev.File, err)
+	ev.Event = "failed"
+	ev.Error = err.Error()
+	s.record(ev)
+
+	if s.FailFast || errors.Is(err, ErrAuth) || errors.Is(err, context.Canceled) {
+		return fmt.Errorf("%w after error in %s: %w", ErrStopped, ev.File, err)
+	}
+	return nil
+}
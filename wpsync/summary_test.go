@@ -0,0 +1,98 @@
+package wpsync
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// TestCreateFailure records a failed post and keeps going
+func TestCreateFailure(t *testing.T) {
+	defer chdirTemp(t)()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("title") == "Bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"code":"rest_invalid_param","message":"Invalid parameter(s): date","data":{"status":400}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": 3}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+
+	created, _ := s.createPosts(context.Background(), []Post{
+		{Title: "Bad", LocalFile: "bad.md"},
+		{Title: "Good", LocalFile: "good.md"},
+	})
+
+	if len(created) != 1 || created[0].LocalFile != "good.md" {
+		t.Error("Expected good post created", created)
+	}
+	if len(s.Summary.Failures) != 1 {
+		t.Fatal("Expected one failure", s.Summary.Failures)
+	}
+	f := s.Summary.Failures[0]
+	if f.File != "posts/bad.md" || f.Type != typePost || f.Action != "create" || f.Error == "" {
+		t.Error("Failure not recorded", f)
+	}
+	if _, ok := stateOf(t, s).Items["posts/bad.md"]; ok {
+		t.Error("Failed post saved in state")
+	}
+}
+
+// TestSaveFailure records a post whose state can not be
+// written as failed, not created
+func TestSaveFailure(t *testing.T) {
+	defer chdirTemp(t)()
+
+	// a file where the state directory should be
+	ioutil.WriteFile(stateDir, []byte{}, 0644)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 3}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+
+	created, _ := s.createPosts(context.Background(), []Post{{Title: "Good", LocalFile: "good.md"}})
+	if len(created) != 0 || s.Summary.Created != 0 {
+		t.Error("Expected no post counted as created", created)
+	}
+	if len(s.Summary.Failures) != 1 || s.Summary.Failures[0].Action != "save" {
+		t.Error("Expected save failure", s.Summary.Failures)
+	}
+}
+
+// TestDryrun records what would change without any request
+// or state written
+func TestDryrun(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("posts", 0755)
+	ioutil.WriteFile("posts/new.md", []byte("---\ntitle: New\nwpsync_id: a1\n---\nHi"), 0644)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Unexpected request in dry run", r.Method, r.URL)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, ""), Dryrun: true}
+	summary, err := s.Push(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Created != 1 || len(summary.Events) != 1 || summary.Events[0].Event != "would-create" {
+		t.Error("Expected would-create event", summary.Events)
+	}
+	if fileExists(statePath("")) {
+		t.Error("State written in dry run")
+	}
+}
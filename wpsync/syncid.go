@@ -0,0 +1,87 @@
+package wpsync
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// metaIdKey is the front matter and post meta key holding the
+// wpsync id, it stays with the content when a file is renamed
+const metaIdKey = "wpsync_id"
+
+// newSyncId returns a random (version 4) UUID
+func newSyncId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// readSyncId returns the wpsync id from a markdown file's
+// front matter, empty if it has none
+func readSyncId(filename string) string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+
+	lines := strings.Split(string(data), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return ""
+	}
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "---" {
+			break
+		}
+		colonIndex := strings.Index(line, ":")
+		if colonIndex > 0 && strings.TrimSpace(line[:colonIndex]) == metaIdKey {
+			return strings.Trim(strings.TrimSpace(line[colonIndex+1:]), "\"")
+		}
+	}
+	return ""
+}
+
+// writeSyncId adds the wpsync id to a markdown file's front
+// matter, creating the front matter if the file has none
+func writeSyncId(filename, id string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	idLine := metaIdKey + ": " + id
+	content := string(data)
+	lines := strings.SplitN(content, "\n", 2)
+	if strings.TrimSpace(lines[0]) == "---" && len(lines) == 2 {
+		content = lines[0] + "\n" + idLine + "\n" + lines[1]
+	} else {
+		content = "---\n" + idLine + "\n---\n" + content
+	}
+	return ioutil.WriteFile(filename, []byte(content), 0644)
+}
+
+// ensureSyncId returns the existing id or creates a new one
+// and writes it to the file, s.Dryrun never writes
+func (s *Syncer) ensureSyncId(filename, id string) string {
+	if id != "" || s.Dryrun {
+		return id
+	}
+
+	id, err := newSyncId()
+	if err != nil {
+		log.Warnf("Error creating wpsync id: %v", err)
+		return ""
+	}
+	if err := writeSyncId(filename, id); err != nil {
+		log.Warnf("Error writing wpsync id to %v: %v", filename, err)
+		return ""
+	}
+	log.Debugf("Added %v %v to %v", metaIdKey, id, filename)
+	return id
+}
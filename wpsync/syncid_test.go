@@ -0,0 +1,61 @@
+package wpsync
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestWriteSyncId adds the id to front matter, or creates it
+func TestWriteSyncId(t *testing.T) {
+	defer chdirTemp(t)()
+
+	files := map[string]string{
+		"front.md":   "---\ntitle: Front\n---\nContent",
+		"nofront.md": "Content only",
+	}
+	for f, data := range files {
+		if err := ioutil.WriteFile(f, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		id, err := newSyncId()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeSyncId(f, id); err != nil {
+			t.Fatal(err)
+		}
+		if got := readSyncId(f); got != id {
+			t.Errorf("%s: expected id %s, got %s", f, id, got)
+		}
+	}
+}
+
+// TestRenamedPost matches a renamed file by its wpsync id
+func TestRenamedPost(t *testing.T) {
+	defer chdirTemp(t)()
+
+	os.MkdirAll("posts", 0755)
+	ioutil.WriteFile("posts/new-name.md", []byte("---\nwpsync_id: abc\n---\n"), 0644)
+
+	s := &Syncer{}
+	local := s.getLocalPosts()
+	remote := []Post{{Id: 7, LocalFile: "old-name.md", SyncId: "abc"}}
+
+	newPosts, updatedPosts := s.comparePosts(local, remote)
+	if len(newPosts) != 0 {
+		t.Error("Renamed post should not be new")
+	}
+	if len(updatedPosts) != 1 || updatedPosts[0].Id != 7 || updatedPosts[0].PrevFile != "old-name.md" {
+		t.Error("Renamed post not matched", updatedPosts)
+	}
+
+	// a copy, with the original still present, is skipped
+	ioutil.WriteFile("posts/old-name.md", []byte("---\nwpsync_id: abc\n---\n"), 0644)
+	remote[0].SyncDate = time.Now().Add(time.Hour)
+	newPosts, updatedPosts = s.comparePosts(s.getLocalPosts(), remote)
+	if len(newPosts) != 0 || len(updatedPosts) != 0 {
+		t.Error("Copied post should be skipped", newPosts, updatedPosts)
+	}
+}
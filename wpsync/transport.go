@@ -0,0 +1,103 @@
+package wpsync
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaults used when not set in wpsync.json
+const (
+	defaultConnectTimeout = 10 // seconds
+	defaultTimeout        = 60 // seconds
+)
+
+// newHTTPClient returns the http client for API calls with the
+// timeouts, proxy and TLS settings from wpsync.json applied
+func newHTTPClient(conf Config) (*http.Client, error) {
+	connectTimeout := time.Duration(defaultConnectTimeout) * time.Second
+	if conf.ConnectTimeout > 0 {
+		connectTimeout = time.Duration(conf.ConnectTimeout) * time.Second
+	}
+
+	// timeout waits for the response headers and not the whole
+	// request, so uploading large files is not cut off, the
+	// Client also limits the whole of other requests to it
+	timeout := time.Duration(defaultTimeout) * time.Second
+	if conf.Timeout > 0 {
+		timeout = time.Duration(conf.Timeout) * time.Second
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: timeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          10,
+	}
+
+	// proxy in config takes priority over HTTPS_PROXY
+	if conf.Proxy != "" {
+		proxyURL, err := url.Parse(conf.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, errors.New("Invalid proxy URL: " + conf.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := newTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// newTLSConfig adds the CA bundle to the system roots and loads
+// the client certificate, nil when neither is set
+func newTLSConfig(conf Config) (*tls.Config, error) {
+	if conf.CABundle == "" && conf.ClientCert == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+
+	if conf.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(conf.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates found in CA bundle " + conf.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if conf.ClientCert != "" {
+		// key may be in the same file as the certificate
+		keyFile := conf.ClientKey
+		if keyFile == "" {
+			keyFile = conf.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(conf.ClientCert, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
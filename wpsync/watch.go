@@ -0,0 +1,63 @@
+package wpsync
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ContentDirs returns the posts, pages and media directories
+func (conf Config) ContentDirs() []string {
+	s := &Syncer{Config: conf}
+	return []string{
+		s.path(s.postsDir()),
+		s.path(s.pagesDir()),
+		s.path(s.mediaDir()),
+	}
+}
+
+// PushFiles is Push for only the changed files, given as paths
+// in the ContentDirs. A change to a bundle image or media
+// metadata pushes the post or media it belongs to.
+func (s *Syncer) PushFiles(ctx context.Context, paths []string) (Summary, error) {
+	if err := s.checkDirs(); err != nil {
+		return Summary{}, err
+	}
+
+	keys := map[string]bool{}
+	allMedia := false
+	for _, p := range paths {
+		key, all := s.changedKey(p)
+		keys[key] = true
+		allMedia = allMedia || all
+	}
+	s.filter = func(key string) bool {
+		return keys[key] || allMedia && strings.HasPrefix(key, s.mediaDir()+"/")
+	}
+	defer func() { s.filter = nil }()
+
+	return s.Push(ctx)
+}
+
+// changedKey returns the state key of the item a changed file
+// belongs to, all is true for the media index which may change
+// any media
+func (s *Syncer) changedKey(filename string) (key string, all bool) {
+	if rel, err := filepath.Rel(s.path("."), filename); err == nil {
+		filename = rel
+	}
+	key = path.Clean(filepath.ToSlash(filename))
+	if key == s.mediaDir()+"/"+mediaIndexFile {
+		return "", true
+	}
+	key = strings.TrimSuffix(key, sidecarExt)
+
+	// anything in a bundle directory belongs to its post
+	postsDir := s.postsDir()
+	if rel := strings.TrimPrefix(key, postsDir+"/"); rel != key && strings.Contains(rel, "/") {
+		bundle := strings.SplitN(rel, "/", 2)[0]
+		return postsDir + "/" + bundle + "/" + bundleIndex, false
+	}
+	return key, false
+}
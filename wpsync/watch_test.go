@@ -0,0 +1,94 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestChangedKey maps changed files to the item to push
+func TestChangedKey(t *testing.T) {
+	tests := map[string]string{
+		"posts/hello.md":           "posts/hello.md",
+		"posts/trip/beach.jpg":     "posts/trip/index.md",
+		"posts/trip/beach.jpg.yml": "posts/trip/index.md",
+		"media/photo.jpg.yml":      "media/photo.jpg",
+		"pages/about.md":           "pages/about.md",
+	}
+	s := &Syncer{}
+	for file, want := range tests {
+		if key, all := s.changedKey(file); key != want || all {
+			t.Errorf("changedKey(%v) = %v, want %v", file, key, want)
+		}
+	}
+	if _, all := s.changedKey("media/media.yml"); !all {
+		t.Error("Expected media index to change all media")
+	}
+
+	// paths under Dir are relative to it
+	s.Config.Dir = filepath.Join("site", "blog")
+	if key, _ := s.changedKey(filepath.Join("site", "blog", "posts", "hello.md")); key != "posts/hello.md" {
+		t.Error("Expected key relative to Dir, got", key)
+	}
+}
+
+// TestPushFiles only pushes the changed files
+func TestPushFiles(t *testing.T) {
+	defer chdirTemp(t)()
+	os.MkdirAll("posts", 0755)
+	ioutil.WriteFile("posts/saved.md", []byte("---\ntitle: Saved\nwpsync_id: a1\n---\nHi"), 0644)
+	ioutil.WriteFile("posts/other.md", []byte("---\ntitle: Other\nwpsync_id: b2\n---\nHi"), 0644)
+
+	var created []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		created = append(created, r.FormValue("title"))
+		fmt.Fprint(w, `{"id": 4, "link": "http://x/saved"}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+	summary, err := s.PushFiles(context.Background(), []string{"posts/saved.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0] != "Saved" || summary.Created != 1 {
+		t.Error("Expected only the saved post pushed", created)
+	}
+
+	// media left out of the run is not read or hashed
+	os.MkdirAll("media", 0755)
+	ioutil.WriteFile("media/a.jpg", []byte("a"), 0644)
+	ioutil.WriteFile("media/b.jpg", []byte("b"), 0644)
+	s.filter = func(key string) bool { return key == "media/a.jpg" }
+	if media := s.getLocalMedia(); len(media) != 1 || media[0].Hash == "" {
+		t.Error("Expected only the changed media hashed", media)
+	}
+}
+
+// TestPushFilesAuth stops on a rejected token with an error
+// watch can tell apart from other failures
+func TestPushFilesAuth(t *testing.T) {
+	defer chdirTemp(t)()
+	os.MkdirAll("posts", 0755)
+	ioutil.WriteFile("posts/saved.md", []byte("---\ntitle: Saved\n---\nHi"), 0644)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"code":"rest_not_logged_in","message":"You are not currently logged in.","data":{"status":401}}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	s := &Syncer{Client: NewClient(ts.URL, "")}
+	_, err := s.PushFiles(context.Background(), []string{"posts/saved.md"})
+	if !errors.Is(err, ErrStopped) || !errors.Is(err, ErrAuth) {
+		t.Error("Expected stopped with auth error, got", err)
+	}
+}
@@ -0,0 +1,88 @@
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// defaultWPComAPI is the WordPress.com API, wpcom-api in the
+// config replaces it, for example with a local test server
+const defaultWPComAPI = "https://public-api.wordpress.com/"
+
+// versionedNamespace matches namespaces such as wp/v2
+var versionedNamespace = regexp.MustCompile(`^[a-z0-9-]+/v[0-9]+$`)
+
+// wpcomAPI returns the WordPress.com API base url
+func (conf Config) wpcomAPI() string {
+	if conf.WPComAPI != "" {
+		return strings.TrimSuffix(conf.WPComAPI, "/") + "/"
+	}
+	return defaultWPComAPI
+}
+
+// wpcomSite returns the site as WordPress.com names it in
+// urls, the host of the site url such as example.wordpress.com
+func wpcomSite(siteURL string) string {
+	u, err := url.Parse(siteURL)
+	if err != nil || u.Host == "" {
+		return siteURL
+	}
+	return u.Host
+}
+
+// IsWPCom returns true for a site hosted on WordPress.com,
+// set with wpcom in the config or by a wordpress.com url
+func (conf Config) IsWPCom() bool {
+	return conf.WPCom || strings.HasSuffix(wpcomSite(conf.SiteURL), ".wordpress.com")
+}
+
+// wpcomEndpoint adds the site to an endpoint, WordPress.com
+// serves wp/v2/posts for a site at wp/v2/sites/<site>/posts
+func wpcomEndpoint(endpoint, site string) string {
+	parts := strings.SplitN(endpoint, "/", 3)
+	if len(parts) < 3 || !versionedNamespace.MatchString(parts[0]+"/"+parts[1]) {
+		return endpoint
+	}
+	return parts[0] + "/" + parts[1] + "/sites/" + site + "/" + parts[2]
+}
+
+// AuthorizeURL returns the WordPress.com page that asks the
+// user to allow wpsync to manage the site, the browser is then
+// sent to redirect with a code, or an error, and the state
+func AuthorizeURL(conf Config, clientID, redirect, state string) string {
+	params := url.Values{
+		"client_id":     {clientID},
+		"redirect_uri":  {redirect},
+		"response_type": {"code"},
+		"blog":          {wpcomSite(conf.SiteURL)},
+		"state":         {state},
+	}
+	return conf.wpcomAPI() + "oauth2/authorize?" + params.Encode()
+}
+
+// ExchangeCode trades the code from the authorize redirect
+// for an access token for the site
+func (c *Client) ExchangeCode(ctx context.Context, clientID, secret, redirect, code string) (string, error) {
+	params := url.Values{
+		"client_id":     {clientID},
+		"client_secret": {secret},
+		"redirect_uri":  {redirect},
+		"code":          {code},
+		"grant_type":    {"authorization_code"},
+	}
+
+	var auth struct {
+		AccessToken string `json:"access_token"`
+	}
+	req := request{method: "POST", url: c.apiRoot() + "oauth2/token", params: params, noAuth: true}
+	if err := c.call(ctx, req, &auth); err != nil {
+		return "", err
+	}
+	if auth.AccessToken == "" {
+		return "", errors.New("No access token in response")
+	}
+	return auth.AccessToken, nil
+}
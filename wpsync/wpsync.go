@@ -0,0 +1,347 @@
+// Package wpsync syncs a local directory of markdown posts,
+// pages and media to a WordPress site. The wpsync command is
+// a thin wrapper around it.
+package wpsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Config is the structure of the jwt-auth response and
+// settings, it is used to unmarshal the data
+type Config struct {
+	// Site is the name of the site in the sites list, "" for
+	// the default site, each site keeps its own state
+	Site string `json:"-"`
+
+	// Dir is the directory the content and state are in, the
+	// current directory if empty
+	Dir string `json:"-"`
+
+	SiteURL      string `json:"site-url"`
+	Token        string `json:"token,omitempty"`
+	APIRoot      string `json:"api-root,omitempty"`
+	Retries      *int   `json:"retries,omitempty"` // nil for the default, 0 for none
+	RetryWait    int    `json:"retry-wait,omitempty"`
+	RetryMaxWait int    `json:"retry-max-wait,omitempty"`
+	RateLimit    int    `json:"rate-limit,omitempty"`
+	MediaPolicy  string `json:"media-policy,omitempty"`
+
+	Timeout        int    `json:"timeout,omitempty"`
+	ConnectTimeout int    `json:"connect-timeout,omitempty"`
+	Proxy          string `json:"proxy,omitempty"`
+	CABundle       string `json:"ca-bundle,omitempty"`
+	ClientCert     string `json:"client-cert,omitempty"`
+	ClientKey      string `json:"client-key,omitempty"`
+
+	// WordPress.com sites use OAuth2 and the WordPress.com API
+	WPCom         bool   `json:"wpcom,omitempty"`
+	WPComClientID string `json:"wpcom-client-id,omitempty"`
+	WPComAPI      string `json:"wpcom-api,omitempty"`
+	WPComRedirect string `json:"wpcom-redirect,omitempty"`
+
+	PostsDir string `json:"posts-dir,omitempty"`
+	PagesDir string `json:"pages-dir,omitempty"`
+	MediaDir string `json:"media-dir,omitempty"`
+
+	ProcessImages bool `json:"process-images,omitempty"`
+	ImageMaxSize  int  `json:"image-max-size,omitempty"`
+	ImageQuality  int  `json:"image-quality,omitempty"`
+}
+
+type Post struct {
+	Id        int    `json:"id"`
+	Title     string `json:"-"`
+	Date      string `json:"-"`
+	URL       string `json:"link"`
+	Content   string `json:"-"`
+	Category  string `json:"-"`
+	Status    string `json:"status"`
+	Tags      string `json:"-"`
+	Gallery   string `json:"-"`
+	SyncId    string `json:"-"`
+	LocalFile string
+	Path      string    `json:"-"` // state key, sent as post meta
+	PrevFile  string    `json:"-"`
+	ModDate   time.Time `json:"-"`
+	SyncDate  time.Time
+}
+
+type Page struct {
+	Id        int    `json:"id"`
+	Title     string `json:"-"`
+	URL       string `json:"link"`
+	Content   string `json:"-"`
+	Status    string `json:"status"`
+	ParentId  int    `json:"-"`
+	Template  string `json:"-"`
+	Order     string `json:"-"`
+	SyncId    string `json:"-"`
+	LocalFile string
+	Path      string    `json:"-"` // state key, sent as post meta
+	PrevFile  string    `json:"-"`
+	ModDate   time.Time `json:"-"`
+	SyncDate  time.Time
+}
+
+type Media struct {
+	Id        int       `json:"id"`
+	URL       string    `json:"source_url"`
+	Link      string    `json:"link"`
+	Meta      MediaMeta `json:"-"`
+	MetaHash  string    `json:"-"`
+	Hash      string    `json:"-"`
+	PrevId    int       `json:"-"`
+	PrevURL   string    `json:"-"`
+	Linked    bool      `json:"-"` // found on the site, not uploaded
+	ParentId  int       `json:"-"`
+	Dir       string    `json:"-"`
+	LocalFile string
+}
+
+// Syncer syncs Config.Dir to the site in Config
+type Syncer struct {
+	Config Config
+	Client *Client
+
+	// Dryrun shows what would change without changing it
+	Dryrun bool
+
+	// FailFast stops at the first item that fails, otherwise
+	// the failure is recorded and the run keeps going
+	FailFast bool
+
+	// Confirm is asked before each change, the change is
+	// skipped if it returns false, nil does not ask
+	Confirm func(prompt string) bool
+
+	// OnEvent is called for each item of the run
+	OnEvent func(Event)
+
+	// Summary of the current run
+	Summary Summary
+
+	// filter leaves out files it returns false for, by
+	// state key, nil syncs all files
+	filter func(key string) bool
+
+	// locked is set while this Syncer holds the lock file
+	locked bool
+}
+
+// ErrStopped is returned when a run stops early, with
+// FailFast or when the token is rejected
+var ErrStopped = errors.New("sync stopped")
+
+// New returns a Syncer for the site in conf
+func New(conf Config) (*Syncer, error) {
+	if strings.ContainsAny(conf.Site, `/\.`) {
+		return nil, fmt.Errorf("Invalid site name %q", conf.Site)
+	}
+	c, err := NewClientFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &Syncer{Config: conf, Client: c}, nil
+}
+
+// Check confirms the site and token are set and the token is
+// accepted by the site
+func (s *Syncer) Check(ctx context.Context) error {
+	if s.Config.SiteURL == "" {
+		return errors.New("Site URL not set")
+	}
+	if s.Config.Token == "" {
+		return errors.New("Authentication token not set")
+	}
+
+	err := s.Client.ValidateToken(ctx)
+	if errors.Is(err, ErrNotFound) && s.Client.APIRoot == "" {
+		// no /wp-json/, likely plain permalinks, find where it is
+		root, derr := s.Client.DiscoverAPIRoot(ctx)
+		if derr != nil || root == s.Client.apiRoot() {
+			return err
+		}
+		log.Infof("Using API root %v, set api-root in wpsync.json to skip finding it", root)
+		s.Client.APIRoot = root
+		err = s.Client.ValidateToken(ctx)
+	}
+	return err
+}
+
+// Push creates and updates the site from local media, posts
+// and pages. The summary lists items that failed, the error
+// is for a run that could not complete.
+func (s *Syncer) Push(ctx context.Context) (Summary, error) {
+	s.Summary = Summary{Started: time.Now()}
+	if err := s.start(); err != nil {
+		return s.Summary, err
+	}
+	defer s.ReleaseLock()
+
+	err := s.push(ctx)
+	s.Summary.Finished = time.Now()
+	return s.Summary, err
+}
+
+func (s *Syncer) push(ctx context.Context) error {
+	// media first, a changed file may update references in posts
+	localMedia := s.getLocalMedia()
+	if len(localMedia) > 0 {
+		remoteMedia, err := s.getRemoteMedia()
+		if err != nil {
+			return err
+		}
+		newMedia, updatedMedia := s.compareMedia(localMedia, remoteMedia)
+		if s.Dryrun {
+			for _, m := range newMedia {
+				s.planned("would-create", typeMedia, s.mediaKey(m))
+			}
+			for _, m := range updatedMedia {
+				s.planned("would-update", typeMedia, s.mediaKey(m))
+			}
+		} else {
+			uploadedMedia, err := s.uploadMediaItems(ctx, newMedia)
+			if err != nil {
+				return err
+			}
+			updatedMedia, err = s.updateMediaItems(ctx, updatedMedia)
+			if err != nil {
+				return err
+			}
+			if len(uploadedMedia) == 0 && len(updatedMedia) == 0 {
+				log.Infof("No new media to upload.")
+			}
+		}
+	}
+
+	// posts
+	localPosts := s.filterPosts(s.getLocalPosts())
+	if len(localPosts) > 0 {
+		remotePosts, err := s.getRemotePosts()
+		if err != nil {
+			return err
+		}
+		newPosts, updatedPosts := s.comparePosts(localPosts, remotePosts)
+		if s.Dryrun {
+			for _, p := range newPosts {
+				s.planned("would-create", typePost, stateKey(s.postsDir(), p.LocalFile))
+			}
+			for _, p := range updatedPosts {
+				s.planned("would-update", typePost, stateKey(s.postsDir(), p.LocalFile))
+			}
+		} else {
+			newPosts, err := s.createPosts(ctx, s.loadPostsFromFiles(newPosts))
+			if err != nil {
+				return err
+			}
+			updatedPosts, err = s.updatePosts(ctx, s.loadPostsFromFiles(updatedPosts))
+			if err != nil {
+				return err
+			}
+
+			if len(newPosts) == 0 && len(updatedPosts) == 0 {
+				log.Infof("No posts to write.")
+			}
+		}
+	}
+
+	// pages
+	localPages := s.filterPages(s.getLocalPages())
+	if len(localPages) > 0 {
+		remotePages, err := s.getRemotePages()
+		if err != nil {
+			return err
+		}
+		newPages, updatedPages := s.comparePages(localPages, remotePages)
+		if s.Dryrun {
+			for _, p := range newPages {
+				s.planned("would-create", typePage, stateKey(s.pagesDir(), p.LocalFile))
+			}
+			for _, p := range updatedPages {
+				s.planned("would-update", typePage, stateKey(s.pagesDir(), p.LocalFile))
+			}
+		} else {
+			newPages, err := s.createPages(ctx, s.loadPagesFromFiles(newPages))
+			if err != nil {
+				return err
+			}
+			updatedPages, err = s.updatePages(ctx, s.loadPagesFromFiles(updatedPages))
+			if err != nil {
+				return err
+			}
+
+			if len(newPages) == 0 && len(updatedPages) == 0 {
+				log.Infof("No pages to write.")
+			}
+		}
+	}
+	return nil
+}
+
+// start checks the settings and takes the lock, called at the
+// start of a run, which must call ReleaseLock when done
+func (s *Syncer) start() error {
+	if err := s.checkDirs(); err != nil {
+		return err
+	}
+	if err := s.lock(); err != nil {
+		return err
+	}
+	if err := s.checkState(); err != nil {
+		s.ReleaseLock()
+		return err
+	}
+	return nil
+}
+
+// checkDirs returns an error for a content directory outside Dir
+func (s *Syncer) checkDirs() error {
+	for _, dir := range []string{s.postsDir(), s.pagesDir(), s.mediaDir()} {
+		if filepath.IsAbs(dir) || strings.HasPrefix(dir, "..") {
+			return fmt.Errorf("Content directory %v must be inside %v", dir, s.dirName())
+		}
+	}
+	return nil
+}
+
+// content directories, as state key prefixes relative to Dir
+func (s *Syncer) postsDir() string { return contentDir(s.Config.PostsDir, "posts") }
+func (s *Syncer) pagesDir() string { return contentDir(s.Config.PagesDir, "pages") }
+func (s *Syncer) mediaDir() string { return contentDir(s.Config.MediaDir, "media") }
+
+// path returns the file for a state key or a name in Dir
+func (s *Syncer) path(key string) string {
+	return filepath.Join(s.Config.Dir, filepath.FromSlash(key))
+}
+
+// dirName returns Dir for messages
+func (s *Syncer) dirName() string {
+	if s.Config.Dir == "" {
+		return "the current directory"
+	}
+	return s.Config.Dir
+}
+
+// contentDir returns the configured directory as a clean
+// slash path, or def when it is not set
+func contentDir(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return path.Clean(filepath.ToSlash(value))
+}
+
+// confirm asks before a change, when Confirm is set
+func (s *Syncer) confirm(prompt string) bool {
+	if s.Confirm == nil {
+		return true
+	}
+	return s.Confirm(prompt)
+}